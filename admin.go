@@ -0,0 +1,481 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michael1011/lightningtip/backends"
+	"github.com/michael1011/lightningtip/database"
+	"github.com/michael1011/lightningtip/version"
+)
+
+type tipResponse struct {
+	ID         int64
+	Date       int64
+	Amount     int64
+	AmountMsat int64
+	Message    string
+	Nickname   string
+	Goal       string
+	Jar        string
+	Fiat       float64
+	Currency   string
+	Rate       float64
+	RHash      string
+	Keysend    bool
+	Hidden     bool
+}
+
+type tipRequest struct {
+	ID     int64
+	Hidden bool
+}
+
+type deleteTipResponse struct {
+	Deleted bool
+}
+
+type hideTipResponse struct {
+	Hidden bool
+}
+
+type pendingInvoiceResponse struct {
+	Invoice    string
+	RHash      string
+	Amount     int64
+	AmountMsat int64
+	Message    string
+	Fiat       float64
+	Currency   string
+	Rate       float64
+	Expiry     int64
+}
+
+type backendStatusResponse struct {
+	Name      string
+	Connected bool
+	Healthy   bool
+	Error     string
+}
+
+type statusResponse struct {
+	Version         string
+	Backends        []backendStatusResponse
+	PendingInvoices int
+	HeldInvoices    int
+}
+
+type holdInvoiceResponse struct {
+	Invoice    string
+	RHash      string
+	Amount     int64
+	AmountMsat int64
+	Message    string
+	Fiat       float64
+	Currency   string
+	Rate       float64
+	AcceptDate int64
+}
+
+type holdInvoiceRequest struct {
+	RHash string
+}
+
+type settleHoldInvoiceResponse struct {
+	Settled bool
+}
+
+type cancelHoldInvoiceResponse struct {
+	Canceled bool
+}
+
+// The admin interface listens on a separate host which should not be reachable from the internet
+// and every request has to be authenticated with the admin token
+func startAdminServer() {
+	mux := http.NewServeMux()
+
+	mux.Handle("/", handleAdminAuth(notFoundHandler))
+	mux.Handle("/status", handleAdminAuth(statusHandler))
+	mux.Handle("/tips", handleAdminAuth(tipsHandler))
+	mux.Handle("/tips/delete", handleAdminAuth(deleteTipHandler))
+	mux.Handle("/tips/hide", handleAdminAuth(hideTipHandler))
+	mux.Handle("/invoices/pending", handleAdminAuth(pendingInvoicesHandler))
+	mux.Handle("/holdinvoices", handleAdminAuth(holdInvoicesHandler))
+	mux.Handle("/holdinvoices/settle", handleAdminAuth(settleHoldInvoiceHandler))
+	mux.Handle("/holdinvoices/cancel", handleAdminAuth(cancelHoldInvoiceHandler))
+
+	log.Info("Starting admin HTTP server on: " + cfg.AdminHost)
+
+	go func() {
+		err := http.ListenAndServe(cfg.AdminHost, mux)
+
+		if err != nil {
+			log.Error("Failed to start admin HTTP server: " + fmt.Sprint(err))
+
+			os.Exit(1)
+		}
+
+	}()
+}
+
+// Requests have to contain the admin token in the header "Authorization: Bearer <token>"
+func handleAdminAuth(handler func(w http.ResponseWriter, r *http.Request)) http.Handler {
+	expected := []byte("Bearer " + cfg.AdminToken)
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		// Comparing in constant time makes sure the token can't be guessed by measuring how long requests take
+		if subtle.ConstantTimeCompare([]byte(request.Header.Get("Authorization")), expected) != 1 {
+			log.Warning("Unauthorized request to admin interface from " + request.RemoteAddr)
+
+			writer.Header().Set("WWW-Authenticate", "Bearer")
+			writer.WriteHeader(http.StatusUnauthorized)
+
+			writer.Write(marshalJSON(errorResponse{
+				Error: "Unauthorized",
+			}))
+
+			return
+		}
+
+		handler(writer, request)
+	})
+}
+
+// Shows the version of LightningTip and whether the backends are reachable
+func statusHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeError(writer, couldNotParseError)
+
+		return
+	}
+
+	var statuses []backendStatusResponse
+
+	err := backend.KeepAliveRequest()
+
+	if failover, ok := backend.(*backends.Failover); ok {
+		// The keep alive request of the failover backend updates the state of all backends
+		for _, status := range failover.Statuses() {
+			statuses = append(statuses, backendStatusResponse{
+				Name:      status.Name,
+				Connected: status.Connected,
+				Healthy:   status.Healthy,
+			})
+		}
+
+	} else {
+		status := backendStatusResponse{
+			Name: backendNames[0],
+		}
+
+		// The default macaroon of LND doesn't allow the keep alive request but a denied request still
+		// shows that the connection works
+		if err == nil || strings.Contains(err.Error(), "permission denied") {
+			status.Connected = true
+			status.Healthy = true
+
+		} else {
+			status.Error = err.Error()
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	writer.Write(marshalJSON(statusResponse{
+		Version:         version.Version,
+		Backends:        statuses,
+		PendingInvoices: pendingInvoices.Len(),
+		HeldInvoices:    len(heldInvoices.all()),
+	}))
+}
+
+// Lists received tips with the most recent first. The query parameters "from" and "to" (Unix timestamps),
+// "min" and "max" (satoshis), "message", "jar", "hidden" (true or false), "limit" and "offset" filter them
+func tipsHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeError(writer, couldNotParseError)
+
+		return
+	}
+
+	filter, ok := parseTipFilter(request)
+
+	if !ok {
+		writeError(writer, couldNotParseError)
+
+		return
+	}
+
+	tips, err := database.GetTips(filter)
+
+	if err != nil {
+		log.Error("Failed to get tips from database: " + fmt.Sprint(err))
+
+		writeError(writer, "Failed to get tips")
+
+		return
+	}
+
+	response := []tipResponse{}
+
+	for _, tip := range tips {
+		response = append(response, tipResponse{
+			ID:         tip.ID,
+			Date:       tip.Date.Unix(),
+			Amount:     tip.AmountMsat / 1000,
+			AmountMsat: tip.AmountMsat,
+			Message:    tip.Message,
+			Nickname:   tip.Nickname,
+			Goal:       tip.Goal,
+			Jar:        tip.Jar,
+			Fiat:       tip.Fiat,
+			Currency:   tip.Currency,
+			Rate:       tip.Rate,
+			RHash:      tip.RHash,
+			Keysend:    tip.Keysend,
+			Hidden:     tip.Hidden,
+		})
+	}
+
+	writer.Write(marshalJSON(response))
+}
+
+func parseTipFilter(request *http.Request) (filter database.TipFilter, ok bool) {
+	query := request.URL.Query()
+
+	filter.Message = query.Get("message")
+	filter.Jar = query.Get("jar")
+
+	switch query.Get("hidden") {
+	case "":
+		// Hidden tips are listed too
+
+	case "false":
+		filter.ExcludeHidden = true
+
+	default:
+		return filter, false
+	}
+
+	var values [6]int64
+
+	for index, key := range []string{"from", "to", "min", "max", "limit", "offset"} {
+		if value := query.Get(key); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+
+			if err != nil || parsed < 0 {
+				return filter, false
+			}
+
+			values[index] = parsed
+		}
+
+	}
+
+	if values[0] > 0 {
+		filter.From = time.Unix(values[0], 0)
+	}
+
+	if values[1] > 0 {
+		filter.To = time.Unix(values[1], 0)
+	}
+
+	filter.MinAmountMsat = values[2] * 1000
+	filter.MaxAmountMsat = values[3] * 1000
+
+	filter.Limit = values[4]
+	filter.Offset = values[5]
+
+	return filter, true
+}
+
+func deleteTipHandler(writer http.ResponseWriter, request *http.Request) {
+	var body tipRequest
+
+	if !parseAdminRequest(writer, request, &body) {
+		return
+	}
+
+	deleted, err := database.DeleteTip(body.ID)
+
+	if err != nil {
+		log.Error("Failed to delete tip: " + fmt.Sprint(err))
+
+		writeError(writer, "Failed to delete tip")
+
+		return
+	}
+
+	if !deleted {
+		writeError(writer, "Tip not found")
+
+		return
+	}
+
+	log.Info("Deleted tip " + strconv.FormatInt(body.ID, 10))
+
+	publishTipHidden(body.ID)
+
+	writer.Write(marshalJSON(deleteTipResponse{
+		Deleted: true,
+	}))
+}
+
+// Hidden tips are not shown publicly. Setting "Hidden" to false shows them again or approves them
+func hideTipHandler(writer http.ResponseWriter, request *http.Request) {
+	var body tipRequest
+
+	if !parseAdminRequest(writer, request, &body) {
+		return
+	}
+
+	tips, err := database.GetTips(database.TipFilter{
+		ID: body.ID,
+	})
+
+	if err == nil {
+		_, err = database.HideTip(body.ID, body.Hidden)
+	}
+
+	if err != nil {
+		log.Error("Failed to hide tip: " + fmt.Sprint(err))
+
+		writeError(writer, "Failed to hide tip")
+
+		return
+	}
+
+	if len(tips) == 0 {
+		writeError(writer, "Tip not found")
+
+		return
+	}
+
+	if body.Hidden {
+		publishTipHidden(body.ID)
+
+	} else if tips[0].Hidden {
+		publishApprovedTip(tips[0])
+	}
+
+	writer.Write(marshalJSON(hideTipResponse{
+		Hidden: body.Hidden,
+	}))
+}
+
+// Lists the invoices that were neither paid nor expired yet
+func pendingInvoicesHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeError(writer, couldNotParseError)
+
+		return
+	}
+
+	response := []pendingInvoiceResponse{}
+
+	for _, invoice := range pendingInvoices.All() {
+		response = append(response, pendingInvoiceResponse{
+			Invoice:    invoice.Invoice,
+			RHash:      invoice.RHash,
+			Amount:     invoice.AmountMsat / 1000,
+			AmountMsat: invoice.AmountMsat,
+			Message:    invoice.Message,
+			Fiat:       invoice.Fiat,
+			Currency:   invoice.Currency,
+			Rate:       invoice.Rate,
+			Expiry:     invoice.Expiry.Unix(),
+		})
+	}
+
+	writer.Write(marshalJSON(response))
+}
+
+// Lists the tips that were paid with hold invoices and wait to be settled or canceled
+func holdInvoicesHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeError(writer, couldNotParseError)
+
+		return
+	}
+
+	response := []holdInvoiceResponse{}
+
+	for _, invoice := range heldInvoices.all() {
+		response = append(response, holdInvoiceResponse{
+			Invoice:    invoice.Invoice,
+			RHash:      invoice.RHash,
+			Amount:     invoice.AmountMsat / 1000,
+			AmountMsat: invoice.AmountMsat,
+			Message:    invoice.Message,
+			Fiat:       invoice.Fiat,
+			Currency:   invoice.Currency,
+			Rate:       invoice.Rate,
+			AcceptDate: invoice.AcceptDate.Unix(),
+		})
+	}
+
+	writer.Write(marshalJSON(response))
+}
+
+func settleHoldInvoiceHandler(writer http.ResponseWriter, request *http.Request) {
+	var body holdInvoiceRequest
+
+	if !parseAdminRequest(writer, request, &body) {
+		return
+	}
+
+	if err := settleHoldInvoice(body.RHash); err != nil {
+		log.Warning("Failed to settle hold invoice: " + fmt.Sprint(err))
+
+		writeError(writer, "Failed to settle hold invoice: "+fmt.Sprint(err))
+
+		return
+	}
+
+	writer.Write(marshalJSON(settleHoldInvoiceResponse{
+		Settled: true,
+	}))
+}
+
+func cancelHoldInvoiceHandler(writer http.ResponseWriter, request *http.Request) {
+	var body holdInvoiceRequest
+
+	if !parseAdminRequest(writer, request, &body) {
+		return
+	}
+
+	if err := cancelHoldInvoice(body.RHash); err != nil {
+		log.Warning("Failed to cancel hold invoice: " + fmt.Sprint(err))
+
+		writeError(writer, "Failed to cancel hold invoice: "+fmt.Sprint(err))
+
+		return
+	}
+
+	writer.Write(marshalJSON(cancelHoldInvoiceResponse{
+		Canceled: true,
+	}))
+}
+
+// Parses the JSON body of a POST request and writes an error if that fails
+func parseAdminRequest(writer http.ResponseWriter, request *http.Request, body interface{}) bool {
+	if request.Method == http.MethodPost {
+		data, _ := ioutil.ReadAll(request.Body)
+
+		if json.Unmarshal(data, body) == nil {
+			return true
+		}
+
+	}
+
+	writeError(writer, couldNotParseError)
+
+	return false
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michael1011/lightningtip/backends"
+	"github.com/michael1011/lightningtip/database"
+)
+
+const testAdminToken = "secret"
+
+// Sends an authenticated request to an admin handler and decodes its response. The status code is returned too
+func callAdminHandler(t *testing.T, handler http.HandlerFunc, method string, body string, response interface{}) int {
+	request := httptest.NewRequest(method, "/", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+testAdminToken)
+
+	recorder := httptest.NewRecorder()
+
+	handleAdminAuth(handler).ServeHTTP(recorder, request)
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+		t.Fatalf("could not decode response %s: %v", recorder.Body.String(), err)
+	}
+
+	return recorder.Code
+}
+
+// Pays an invoice for a tip and returns the ID of the tip
+func addTestTip(t *testing.T) int64 {
+	pending := addTestInvoice(t, time.Now().Add(time.Hour))
+
+	publishInvoiceSettled(backends.SettledInvoice{
+		Invoice: pending.Invoice,
+		RHash:   pending.RHash,
+	})
+
+	tips, err := database.GetTips(database.TipFilter{})
+
+	if err != nil || len(tips) == 0 {
+		t.Fatalf("tip was not recorded: %v", err)
+	}
+
+	return tips[0].ID
+}
+
+func TestAdminAuth(t *testing.T) {
+	_, tearDown := setUpMockBackend(t)
+	defer tearDown()
+
+	cfg.AdminToken = testAdminToken
+
+	handler := handleAdminAuth(tipsHandler)
+
+	headers := map[string]int{
+		"":                               http.StatusUnauthorized,
+		testAdminToken:                   http.StatusUnauthorized,
+		"Bearer wrong":                   http.StatusUnauthorized,
+		"Bearer " + testAdminToken + "a": http.StatusUnauthorized,
+		"Basic " + testAdminToken:        http.StatusUnauthorized,
+		"Bearer " + testAdminToken:       http.StatusOK,
+	}
+
+	for header, expected := range headers {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		if header != "" {
+			request.Header.Set("Authorization", header)
+		}
+
+		recorder := httptest.NewRecorder()
+
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != expected {
+			t.Errorf("request with authorization %s was answered with %d", header, recorder.Code)
+		}
+
+		if expected == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("unauthorized request with authorization %s did not get challenge", header)
+		}
+
+	}
+
+}
+
+func TestAdminDeleteTip(t *testing.T) {
+	_, tearDown := setUpMockBackend(t)
+	defer tearDown()
+
+	cfg.AdminToken = testAdminToken
+
+	id := addTestTip(t)
+	body := `{"ID": ` + strconv.FormatInt(id, 10) + `}`
+
+	var response deleteTipResponse
+
+	if code := callAdminHandler(t, deleteTipHandler, http.MethodPost, body, &response); code != http.StatusOK || !response.Deleted {
+		t.Errorf("tip was not deleted: %d %v", code, response)
+	}
+
+	assertTips(t, 0)
+
+	var errResponse errorResponse
+
+	if callAdminHandler(t, deleteTipHandler, http.MethodPost, body, &errResponse); errResponse.Error != "Tip not found" {
+		t.Errorf("deleting unknown tip was answered with %v", errResponse)
+	}
+
+	if code := callAdminHandler(t, deleteTipHandler, http.MethodGet, "", &errResponse); code != http.StatusBadRequest {
+		t.Errorf("GET request was answered with %d", code)
+	}
+
+}
+
+func TestAdminHideTip(t *testing.T) {
+	_, tearDown := setUpMockBackend(t)
+	defer tearDown()
+
+	cfg.AdminToken = testAdminToken
+
+	id := addTestTip(t)
+
+	hide := func(hidden bool) {
+		var response hideTipResponse
+
+		body := `{"ID": ` + strconv.FormatInt(id, 10) + `, "Hidden": ` + strconv.FormatBool(hidden) + `}`
+
+		if code := callAdminHandler(t, hideTipHandler, http.MethodPost, body, &response); code != http.StatusOK || response.Hidden != hidden {
+			t.Errorf("unexpected response to hiding tip: %d %v", code, response)
+		}
+
+		tips, _ := database.GetTips(database.TipFilter{ID: id})
+
+		if len(tips) != 1 || tips[0].Hidden != hidden {
+			t.Errorf("tip was not changed to hidden %t: %v", hidden, tips)
+		}
+
+	}
+
+	hide(true)
+	hide(false)
+
+	var errResponse errorResponse
+
+	if callAdminHandler(t, hideTipHandler, http.MethodPost, `{"ID": 1000, "Hidden": true}`, &errResponse); errResponse.Error != "Tip not found" {
+		t.Errorf("hiding unknown tip was answered with %v", errResponse)
+	}
+
+	if code := callAdminHandler(t, hideTipHandler, http.MethodPost, "not json", &errResponse); code != http.StatusBadRequest {
+		t.Errorf("invalid request was answered with %d", code)
+	}
+
+}
+
+func TestAdminHoldInvoices(t *testing.T) {
+	mock, tearDown := setUpHoldInvoices(t, holdModeManual)
+	defer tearDown()
+
+	cfg.AdminToken = testAdminToken
+
+	settled := payHoldInvoice(t, mock, "thanks")
+	canceled := payHoldInvoice(t, mock, "spam")
+
+	var held []holdInvoiceResponse
+
+	if callAdminHandler(t, holdInvoicesHandler, http.MethodGet, "", &held); len(held) != 2 {
+		t.Fatalf("unexpected hold invoices %v", held)
+	}
+
+	var settleResponse settleHoldInvoiceResponse
+
+	code := callAdminHandler(t, settleHoldInvoiceHandler, http.MethodPost, `{"RHash": "`+settled.RHash+`"}`, &settleResponse)
+
+	if code != http.StatusOK || !settleResponse.Settled {
+		t.Errorf("hold invoice was not settled: %d %v", code, settleResponse)
+	}
+
+	assertInvoiceState(t, settled.RHash, database.InvoiceSettled)
+
+	var cancelResponse cancelHoldInvoiceResponse
+
+	code = callAdminHandler(t, cancelHoldInvoiceHandler, http.MethodPost, `{"RHash": "`+canceled.RHash+`"}`, &cancelResponse)
+
+	if code != http.StatusOK || !cancelResponse.Canceled {
+		t.Errorf("hold invoice was not canceled: %d %v", code, cancelResponse)
+	}
+
+	assertInvoiceState(t, canceled.RHash, database.InvoiceCanceled)
+	assertTips(t, 1)
+
+	// Invoices that are not held anymore can neither be settled nor canceled
+	for _, handler := range []http.HandlerFunc{settleHoldInvoiceHandler, cancelHoldInvoiceHandler} {
+		var errResponse errorResponse
+
+		code = callAdminHandler(t, handler, http.MethodPost, `{"RHash": "`+canceled.RHash+`"}`, &errResponse)
+
+		if code != http.StatusBadRequest || errResponse.Error == "" {
+			t.Errorf("invoice that is not held anymore was answered with %d %v", code, errResponse)
+		}
+
+	}
+
+	if callAdminHandler(t, holdInvoicesHandler, http.MethodGet, "", &held); len(held) != 0 {
+		t.Errorf("unexpected hold invoices %v", held)
+	}
+
+}
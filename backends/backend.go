@@ -1,21 +1,129 @@
 package backends
 
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+// Returned by backends that can't create invoices with an amount that is not a whole number of satoshis
+var errFractionalSatoshis = errors.New("backend supports only amounts of whole satoshis")
+
+// ErrHoldInvoicesNotSupported is returned by the hold invoice methods of backends that don't support them
+var ErrHoldInvoicesNotSupported = errors.New("backend does not support hold invoices")
+
+// ErrPaymentsNotSupported is returned by the payment methods of backends that can't send that kind of payment
+var ErrPaymentsNotSupported = errors.New("backend does not support this kind of payment")
+
+// PaymentFailedError is returned for payments that definitely failed. Those can be retried without the risk
+// of paying twice while payments that returned other errors could still be in flight or even have succeeded
+type PaymentFailedError struct {
+	Reason string
+}
+
+func (err *PaymentFailedError) Error() string {
+	return err.Reason
+}
+
+// The TLV record in which senders of keysend payments put their message
+const keysendMessageRecord = 34349334
+
+// The TLV record that contains the preimage of keysend payments
+const keysendPreimageRecord = 5482373484
+
+// Payment is a payment that was sent successfully
+type Payment struct {
+	RHash    string
+	Preimage string
+	FeeMsat  int64
+}
+
+// SettledInvoice is an invoice that was paid
+type SettledInvoice struct {
+	Invoice string
+	RHash   string
+
+	// Spontaneous payments like keysend and AMP are not requested with an invoice which is why they have
+	// no invoice string. Their amount and the message of the sender are taken from the payment itself
+	Keysend    bool
+	AmountMsat int64
+	Message    string
+}
+
 // PublishInvoiceSettled is a callback for a settled invoice
-type PublishInvoiceSettled func(invoice string)
+type PublishInvoiceSettled func(settled SettledInvoice)
 
 // RescanPendingInvoices is a callbacks when reconnecting
 type RescanPendingInvoices func()
 
+// InvoiceOptions are the properties of an invoice that is created by a backend
+// Backends that don't support private route hints or fallback addresses ignore them
+type InvoiceOptions struct {
+	Description string
+
+	// If set the invoice commits to the SHA256 hash of the description instead of containing it
+	HashDescription bool
+
+	AmountMsat int64
+
+	// Expiry of the invoice in seconds
+	Expiry int64
+
+	// Whether route hints for private channels should be added to the invoice
+	Private bool
+
+	// On-chain address the payer can fall back to
+	FallbackAddr string
+}
+
 // Backend is an interface that would allow for different implementations of Lightning to be used as backend
 type Backend interface {
 	Connect() error
 
-	// The amount is denominated in satoshis and the expiry in seconds
-	GetInvoice(description string, amount int64, expiry int64) (invoice string, rHash string, err error)
+	GetInvoice(options InvoiceOptions) (invoice string, rHash string, err error)
 
 	InvoiceSettled(rHash string) (settled bool, err error)
 
 	SubscribeInvoices(publish PublishInvoiceSettled, rescan RescanPendingInvoices) error
 
 	KeepAliveRequest() error
+
+	// Hold invoices are not settled when they are paid. The payment is held until the invoice is either settled
+	// with the preimage of the payment hash or canceled which refunds the payer
+	AddHoldInvoice(options InvoiceOptions, paymentHash []byte) (invoice string, err error)
+
+	// Whether a hold invoice was paid and is waiting to be settled or canceled
+	HoldInvoiceAccepted(rHash string) (accepted bool, err error)
+
+	SettleHoldInvoice(preimage []byte) error
+
+	CancelHoldInvoice(rHash string) error
+
+	// Payments block until they either succeeded or failed. The routing fee is limited to maxFeeMsat
+	PayInvoice(invoice string, maxFeeMsat int64) (payment Payment, err error)
+
+	// Keysend payments don't need an invoice but only the public key of the recipient
+	SendKeysend(pubkey string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error)
+
+	// BOLT12 offers are static and the backend fetches an invoice for the amount from the recipient
+	PayOffer(offer string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error)
+}
+
+// Returns a random preimage and its payment hash
+func newPreimage() (preimage []byte, paymentHash []byte, err error) {
+	preimage = make([]byte, 32)
+
+	if _, err = rand.Read(preimage); err != nil {
+		return nil, nil, err
+	}
+
+	hash := sha256.Sum256(preimage)
+
+	return preimage, hash[:], err
+}
+
+func getDescriptionHash(description string) []byte {
+	hash := sha256.Sum256([]byte(description))
+
+	return hash[:]
 }
@@ -0,0 +1,392 @@
+package backends
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// CLN contains all values needed to be able to connect to a Core Lightning node
+type CLN struct {
+	RPCFile string `long:"rpcfile" Description:"Path to the JSON-RPC socket of lightningd"`
+
+	requestID uint64
+}
+
+type clnRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      uint64      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type clnError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *clnError) Error() string {
+	return err.Message
+}
+
+// Errors of "pay" and "keysend" after which the payment is known to have failed. The others, like the one
+// for payments that are still pending, leave the outcome open
+var clnPaymentFailedCodes = map[int]bool{
+	// Invalid parameters
+	-32602: true,
+	// Permanent failure at the destination
+	203: true,
+	// No route found
+	205: true,
+	// Route too expensive
+	206: true,
+	// Invoice expired
+	207: true,
+	// Gave up retrying without success
+	210: true,
+}
+
+type clnResponse struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *clnError       `json:"error"`
+}
+
+type clnInvoice struct {
+	Label       string `json:"label"`
+	Bolt11      string `json:"bolt11"`
+	Description string `json:"description"`
+	PaymentHash string `json:"payment_hash"`
+	Status      string `json:"status"`
+	PayIndex    uint64 `json:"pay_index"`
+
+	// Older versions of CLN encode amounts as strings with the suffix "msat"
+	AmountReceivedMsat json.RawMessage `json:"amount_received_msat"`
+}
+
+type clnListInvoices struct {
+	Invoices []clnInvoice `json:"invoices"`
+}
+
+// Response of "pay" and "keysend"
+type clnPayment struct {
+	PaymentHash     string `json:"payment_hash"`
+	PaymentPreimage string `json:"payment_preimage"`
+	Status          string `json:"status"`
+
+	AmountMsat     json.RawMessage `json:"amount_msat"`
+	AmountSentMsat json.RawMessage `json:"amount_sent_msat"`
+}
+
+type clnFetchInvoice struct {
+	Invoice string `json:"invoice"`
+}
+
+const clnLabelPrefix = "lightningtip-"
+
+// The keysend plugin of CLN creates invoices for received keysend payments with this label prefix
+// and puts the message of the sender into the description after the prefix "keysend: "
+const (
+	clnKeysendLabelPrefix       = "keysend-"
+	clnKeysendDescriptionPrefix = "keysend: "
+)
+
+// Connect to a node
+func (cln *CLN) Connect() error {
+	con, err := net.Dial("unix", cln.RPCFile)
+
+	if err != nil {
+		log.Error("Failed to connect to CLN JSON-RPC socket")
+
+		return err
+	}
+
+	return con.Close()
+}
+
+// GetInvoice gets and invoice from a node
+func (cln *CLN) GetInvoice(options InvoiceOptions) (invoice string, rHash string, err error) {
+	label, err := getInvoiceLabel()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	var response clnInvoice
+
+	params := map[string]interface{}{
+		"amount_msat": options.AmountMsat,
+		"label":       label,
+		"description": options.Description,
+		"expiry":      options.Expiry,
+	}
+
+	// With "deschashonly" CLN puts only the hash of the description into the invoice
+	// It is not set otherwise because older versions of CLN reject unknown parameters
+	if options.HashDescription {
+		params["deschashonly"] = true
+	}
+
+	if options.Private {
+		params["exposeprivatechannels"] = true
+	}
+
+	if options.FallbackAddr != "" {
+		params["fallbacks"] = []string{options.FallbackAddr}
+	}
+
+	err = cln.call("invoice", params, &response)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return response.Bolt11, response.PaymentHash, err
+}
+
+// InvoiceSettled checks if an invoice is settled by looking it up
+func (cln *CLN) InvoiceSettled(rHash string) (settled bool, err error) {
+	var response clnListInvoices
+
+	err = cln.call("listinvoices", map[string]interface{}{
+		"payment_hash": rHash,
+	}, &response)
+
+	if err != nil {
+		return false, err
+	}
+
+	if len(response.Invoices) == 0 {
+		return false, errors.New("could not find invoice")
+	}
+
+	return response.Invoices[0].Status == "paid", err
+}
+
+// SubscribeInvoices waits for invoices of CLN to get paid and calls a callback when one is settled
+// Invoices that were paid after the last pay index that got processed are replayed
+func (cln *CLN) SubscribeInvoices(publish PublishInvoiceSettled, rescan RescanPendingInvoices) error {
+	settleIndexKey := "cln:" + cln.RPCFile
+
+	lastPayIndex := getSettleIndex(settleIndexKey)
+
+	// If there is no pay index stored yet the invoices that are already paid should not be published again
+	if lastPayIndex == 0 {
+		var invoices clnListInvoices
+
+		err := cln.call("listinvoices", map[string]interface{}{}, &invoices)
+
+		if err != nil {
+			return err
+		}
+
+		for _, invoice := range invoices.Invoices {
+			if invoice.PayIndex > lastPayIndex {
+				lastPayIndex = invoice.PayIndex
+			}
+		}
+
+	}
+
+	// Connected successfully to CLN
+	// If there are pending invoices after reconnecting they should get rescanned now
+	rescan()
+
+	for {
+		var invoice clnInvoice
+
+		err := cln.call("waitanyinvoice", map[string]interface{}{
+			"lastpay_index": lastPayIndex,
+		}, &invoice)
+
+		if err != nil {
+			return err
+		}
+
+		lastPayIndex = invoice.PayIndex
+
+		if invoice.Status == "paid" {
+			// The pay index is stored after the invoice was processed to make sure it is not lost
+			publish(invoice.toSettledInvoice())
+
+			setSettleIndex(settleIndexKey, invoice.PayIndex)
+		}
+
+	}
+
+}
+
+func (invoice *clnInvoice) toSettledInvoice() SettledInvoice {
+	settled := SettledInvoice{
+		Invoice: invoice.Bolt11,
+		RHash:   invoice.PaymentHash,
+	}
+
+	// The keysend plugin creates regular invoices with a bolt11 which is why only the label tells them apart
+	if strings.HasPrefix(invoice.Label, clnKeysendLabelPrefix) {
+		settled.Keysend = true
+		settled.AmountMsat = parseClnMsat(invoice.AmountReceivedMsat)
+
+		if strings.HasPrefix(invoice.Description, clnKeysendDescriptionPrefix) {
+			settled.Message = strings.TrimPrefix(invoice.Description, clnKeysendDescriptionPrefix)
+		}
+
+	}
+
+	return settled
+}
+
+// Parses amounts that are either numbers or strings like "1000msat"
+func parseClnMsat(data json.RawMessage) int64 {
+	value := strings.TrimSuffix(strings.Trim(string(data), "\""), "msat")
+
+	amount, _ := strconv.ParseInt(value, 10, 64)
+
+	return amount
+}
+
+// KeepAliveRequest is a dummy request to make sure the connection to CLN works
+func (cln *CLN) KeepAliveRequest() error {
+	var response json.RawMessage
+
+	return cln.call("getinfo", map[string]interface{}{}, &response)
+}
+
+// Every JSON-RPC call opens a new connection to the socket because "waitanyinvoice" blocks until an invoice is paid
+func (cln *CLN) call(method string, params interface{}, result interface{}) error {
+	con, err := net.Dial("unix", cln.RPCFile)
+
+	if err != nil {
+		return err
+	}
+
+	defer con.Close()
+
+	request := clnRequest{
+		JSONRPC: "2.0",
+		ID:      atomic.AddUint64(&cln.requestID, 1),
+		Method:  method,
+		Params:  params,
+	}
+
+	err = json.NewEncoder(con).Encode(request)
+
+	if err != nil {
+		return err
+	}
+
+	var response clnResponse
+
+	err = json.NewDecoder(con).Decode(&response)
+
+	if err != nil {
+		return err
+	}
+
+	if response.Error != nil {
+		return response.Error
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
+
+// Labels of invoices have to be unique in CLN
+func getInvoiceLabel() (string, error) {
+	random := make([]byte, 8)
+
+	_, err := rand.Read(random)
+
+	if err != nil {
+		return "", err
+	}
+
+	return clnLabelPrefix + strconv.FormatInt(time.Now().Unix(), 10) + "-" + hex.EncodeToString(random), nil
+}
+
+// AddHoldInvoice is not supported. CLN needs a plugin for hold invoices
+func (cln *CLN) AddHoldInvoice(options InvoiceOptions, paymentHash []byte) (invoice string, err error) {
+	return "", ErrHoldInvoicesNotSupported
+}
+
+// HoldInvoiceAccepted is not supported
+func (cln *CLN) HoldInvoiceAccepted(rHash string) (accepted bool, err error) {
+	return false, ErrHoldInvoicesNotSupported
+}
+
+// SettleHoldInvoice is not supported
+func (cln *CLN) SettleHoldInvoice(preimage []byte) error {
+	return ErrHoldInvoicesNotSupported
+}
+
+// CancelHoldInvoice is not supported
+func (cln *CLN) CancelHoldInvoice(rHash string) error {
+	return ErrHoldInvoicesNotSupported
+}
+
+// PayInvoice pays an invoice with "pay"
+func (cln *CLN) PayInvoice(invoice string, maxFeeMsat int64) (payment Payment, err error) {
+	return cln.sendPayment("pay", map[string]interface{}{
+		"bolt11": invoice,
+		"maxfee": maxFeeMsat,
+	})
+}
+
+// SendKeysend sends a spontaneous payment with "keysend"
+func (cln *CLN) SendKeysend(pubkey string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error) {
+	return cln.sendPayment("keysend", map[string]interface{}{
+		"destination": pubkey,
+		"amount_msat": amountMsat,
+		"maxfee":      maxFeeMsat,
+	})
+}
+
+// PayOffer fetches an invoice for the amount from the offer and pays it. CLN has to be started
+// with "--experimental-offers" for versions before 24.11
+func (cln *CLN) PayOffer(offer string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error) {
+	var response clnFetchInvoice
+
+	err = cln.call("fetchinvoice", map[string]interface{}{
+		"offer":       offer,
+		"amount_msat": amountMsat,
+	}, &response)
+
+	if err != nil {
+		return payment, err
+	}
+
+	return cln.PayInvoice(response.Invoice, maxFeeMsat)
+}
+
+func (cln *CLN) sendPayment(method string, params map[string]interface{}) (payment Payment, err error) {
+	var response clnPayment
+
+	err = cln.call(method, params, &response)
+
+	if rpcError, ok := err.(*clnError); ok && clnPaymentFailedCodes[rpcError.Code] {
+		return payment, &PaymentFailedError{Reason: rpcError.Message}
+	}
+
+	if err != nil {
+		return payment, err
+	}
+
+	if response.Status == "failed" {
+		return payment, &PaymentFailedError{Reason: "payment failed"}
+	}
+
+	if response.Status != "complete" {
+		return payment, errors.New("payment " + response.Status)
+	}
+
+	return Payment{
+		RHash:    response.PaymentHash,
+		Preimage: response.PaymentPreimage,
+		FeeMsat:  parseClnMsat(response.AmountSentMsat) - parseClnMsat(response.AmountMsat),
+	}, err
+}
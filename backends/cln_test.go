@@ -0,0 +1,315 @@
+package backends
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Answers the JSON-RPC requests on the socket with the result of the handler
+type clnHandler func(method string, params map[string]interface{}) (result interface{}, rpcError *clnError)
+
+func startCLNStub(t *testing.T, handler clnHandler) (cln *CLN, stop func()) {
+	dir, err := ioutil.TempDir("", "lightningtip-cln")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rpcFile := path.Join(dir, "lightning-rpc")
+
+	listener, err := net.Listen("unix", rpcFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			con, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go func(con net.Conn) {
+				defer con.Close()
+
+				var request struct {
+					ID     uint64                 `json:"id"`
+					Method string                 `json:"method"`
+					Params map[string]interface{} `json:"params"`
+				}
+
+				if err := json.NewDecoder(con).Decode(&request); err != nil {
+					return
+				}
+
+				result, rpcError := handler(request.Method, request.Params)
+
+				response := map[string]interface{}{
+					"jsonrpc": "2.0",
+					"id":      request.ID,
+				}
+
+				if rpcError != nil {
+					response["error"] = rpcError
+				} else {
+					response["result"] = result
+				}
+
+				json.NewEncoder(con).Encode(response)
+			}(con)
+		}
+
+	}()
+
+	return &CLN{RPCFile: rpcFile}, func() {
+		listener.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+type memorySettleIndexStore struct {
+	lock    sync.Mutex
+	indexes map[string]uint64
+}
+
+func (store *memorySettleIndexStore) GetSettleIndex(key string) (uint64, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return store.indexes[key], nil
+}
+
+func (store *memorySettleIndexStore) SetSettleIndex(key string, index uint64) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.indexes[key] = index
+
+	return nil
+}
+
+func useMemorySettleIndexStore() (store *memorySettleIndexStore, reset func()) {
+	store = &memorySettleIndexStore{indexes: make(map[string]uint64)}
+
+	UseSettleIndexStore(store)
+
+	return store, func() {
+		UseSettleIndexStore(nil)
+	}
+}
+
+func TestCLNGetInvoice(t *testing.T) {
+	var params map[string]interface{}
+
+	cln, stop := startCLNStub(t, func(method string, p map[string]interface{}) (interface{}, *clnError) {
+		if method != "invoice" {
+			return nil, &clnError{Code: -32601, Message: "unknown method " + method}
+		}
+
+		params = p
+
+		return map[string]interface{}{
+			"bolt11":       "lnbcrt1invoice",
+			"payment_hash": "aabb",
+		}, nil
+	})
+	defer stop()
+
+	invoice, rHash, err := cln.GetInvoice(InvoiceOptions{
+		Description:     "tip",
+		HashDescription: true,
+		AmountMsat:      1500,
+		Expiry:          3600,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if invoice != "lnbcrt1invoice" || rHash != "aabb" {
+		t.Errorf("unexpected invoice %s with hash %s", invoice, rHash)
+	}
+
+	if params["amount_msat"] != float64(1500) || params["description"] != "tip" || params["expiry"] != float64(3600) {
+		t.Errorf("unexpected parameters %v", params)
+	}
+
+	if params["deschashonly"] != true {
+		t.Error("description was not committed to by hash")
+	}
+
+	if label, _ := params["label"].(string); !strings.HasPrefix(label, clnLabelPrefix) {
+		t.Errorf("unexpected label %s", label)
+	}
+
+}
+
+func TestCLNInvoiceSettled(t *testing.T) {
+	cln, stop := startCLNStub(t, func(method string, params map[string]interface{}) (interface{}, *clnError) {
+		var invoices []clnInvoice
+
+		switch params["payment_hash"] {
+		case "paid":
+			invoices = append(invoices, clnInvoice{PaymentHash: "paid", Status: "paid"})
+
+		case "unpaid":
+			invoices = append(invoices, clnInvoice{PaymentHash: "unpaid", Status: "unpaid"})
+		}
+
+		return clnListInvoices{Invoices: invoices}, nil
+	})
+	defer stop()
+
+	if settled, err := cln.InvoiceSettled("paid"); err != nil || !settled {
+		t.Errorf("paid invoice is not settled: %v", err)
+	}
+
+	if settled, err := cln.InvoiceSettled("unpaid"); err != nil || settled {
+		t.Errorf("unpaid invoice is settled: %v", err)
+	}
+
+	if _, err := cln.InvoiceSettled("unknown"); err == nil {
+		t.Error("no error for unknown invoice")
+	}
+
+}
+
+func TestCLNSubscribeInvoices(t *testing.T) {
+	store, reset := useMemorySettleIndexStore()
+	defer reset()
+
+	// Invoices that get paid while the subscription is running
+	paid := []clnInvoice{
+		{Bolt11: "lnbcrt1first", PaymentHash: "first", Status: "paid", PayIndex: 6},
+		{
+			Label:              clnKeysendLabelPrefix + "1",
+			Bolt11:             "lnbcrt1keysend",
+			PaymentHash:        "keysend",
+			Description:        clnKeysendDescriptionPrefix + "thanks",
+			Status:             "paid",
+			PayIndex:           7,
+			AmountReceivedMsat: json.RawMessage("\"21000msat\""),
+		},
+	}
+
+	var lock sync.Mutex
+	var lastPayIndexes []float64
+
+	cln, stop := startCLNStub(t, func(method string, params map[string]interface{}) (interface{}, *clnError) {
+		switch method {
+		case "listinvoices":
+			// The invoices that were paid before the first subscription must not be published
+			return clnListInvoices{Invoices: []clnInvoice{
+				{Bolt11: "lnbcrt1old", Status: "paid", PayIndex: 5},
+				{Bolt11: "lnbcrt1older", Status: "paid", PayIndex: 3},
+				{Bolt11: "lnbcrt1unpaid", Status: "unpaid"},
+			}}, nil
+
+		case "waitanyinvoice":
+			lock.Lock()
+			defer lock.Unlock()
+
+			lastPayIndexes = append(lastPayIndexes, params["lastpay_index"].(float64))
+
+			if len(paid) == 0 {
+				return nil, &clnError{Code: -1, Message: "shutting down"}
+			}
+
+			invoice := paid[0]
+			paid = paid[1:]
+
+			return invoice, nil
+		}
+
+		return nil, &clnError{Code: -32601, Message: "unknown method " + method}
+	})
+	defer stop()
+
+	var published []SettledInvoice
+	rescanned := false
+
+	err := cln.SubscribeInvoices(func(settled SettledInvoice) {
+		published = append(published, settled)
+	}, func() {
+		rescanned = true
+	})
+
+	if err == nil || err.Error() != "shutting down" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if !rescanned {
+		t.Error("pending invoices were not rescanned")
+	}
+
+	expectedIndexes := []float64{5, 6, 7}
+
+	if len(lastPayIndexes) != len(expectedIndexes) {
+		t.Fatalf("unexpected pay indexes %v", lastPayIndexes)
+	}
+
+	for i, index := range expectedIndexes {
+		if lastPayIndexes[i] != index {
+			t.Errorf("unexpected pay indexes %v", lastPayIndexes)
+		}
+
+	}
+
+	if len(published) != 2 {
+		t.Fatalf("unexpected settled invoices %v", published)
+	}
+
+	if published[0].Invoice != "lnbcrt1first" || published[0].Keysend {
+		t.Errorf("unexpected settled invoice %v", published[0])
+	}
+
+	if !published[1].Keysend || published[1].AmountMsat != 21000 || published[1].Message != "thanks" {
+		t.Errorf("unexpected keysend payment %v", published[1])
+	}
+
+	if index, _ := store.GetSettleIndex("cln:" + cln.RPCFile); index != 7 {
+		t.Errorf("stored pay index is %d instead of 7", index)
+	}
+
+	// A new subscription has to resume from the stored pay index without listing the invoices
+	lastPayIndexes = nil
+
+	cln.SubscribeInvoices(func(settled SettledInvoice) {}, func() {})
+
+	if len(lastPayIndexes) != 1 || lastPayIndexes[0] != 7 {
+		t.Errorf("subscription did not resume from stored pay index: %v", lastPayIndexes)
+	}
+
+}
+
+func TestCLNErrorResponse(t *testing.T) {
+	cln, stop := startCLNStub(t, func(method string, params map[string]interface{}) (interface{}, *clnError) {
+		return nil, &clnError{Code: 900, Message: "Duplicate label"}
+	})
+	defer stop()
+
+	_, _, err := cln.GetInvoice(InvoiceOptions{AmountMsat: 1000})
+
+	if err == nil || err.Error() != "Duplicate label" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if err := cln.KeepAliveRequest(); err == nil {
+		t.Error("no error for failed keepalive request")
+	}
+
+	stop()
+
+	if _, _, err := cln.GetInvoice(InvoiceOptions{AmountMsat: 1000}); err == nil {
+		t.Error("no error when the socket is closed")
+	}
+
+}
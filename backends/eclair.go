@@ -0,0 +1,338 @@
+package backends
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Eclair contains all values needed to be able to connect to an Eclair node
+type Eclair struct {
+	URL      string `long:"url" Description:"URL of the HTTP API of Eclair"`
+	Password string `long:"password" Description:"Password of the HTTP API of Eclair"`
+
+	client *http.Client
+}
+
+type eclairError struct {
+	Error string `json:"error"`
+}
+
+type eclairInvoice struct {
+	Serialized  string `json:"serialized"`
+	PaymentHash string `json:"paymentHash"`
+}
+
+type eclairReceivedInfo struct {
+	PaymentRequest eclairInvoice `json:"paymentRequest"`
+
+	Status struct {
+		Type string `json:"type"`
+	} `json:"status"`
+}
+
+type eclairEvent struct {
+	Type        string `json:"type"`
+	PaymentHash string `json:"paymentHash"`
+}
+
+// Blocking payments return the event of the result of the payment
+type eclairPaymentEvent struct {
+	Type            string `json:"type"`
+	PaymentHash     string `json:"paymentHash"`
+	PaymentPreimage string `json:"paymentPreimage"`
+
+	Parts []struct {
+		FeesPaid int64 `json:"feesPaid"`
+	} `json:"parts"`
+}
+
+const (
+	eclairPaymentReceived = "payment-received"
+	eclairPaymentSent     = "payment-sent"
+	eclairPaymentFailed   = "payment-failed"
+)
+
+// Requests to the API are aborted after this. Payments are sent with "blocking" which is why it has to be longer
+// than it takes Eclair to give up on a payment
+var eclairTimeout = 2 * time.Minute
+
+// Connect to a node
+func (eclair *Eclair) Connect() error {
+	_, err := url.Parse(eclair.URL)
+
+	if err != nil {
+		log.Error("Failed to parse URL of Eclair API")
+
+		return err
+	}
+
+	eclair.client = &http.Client{
+		Timeout: eclairTimeout,
+	}
+
+	return err
+}
+
+// GetInvoice gets and invoice from a node
+func (eclair *Eclair) GetInvoice(options InvoiceOptions) (invoice string, rHash string, err error) {
+	var response eclairInvoice
+
+	params := url.Values{
+		"amountMsat": {strconv.FormatInt(options.AmountMsat, 10)},
+		"expireIn":   {strconv.FormatInt(options.Expiry, 10)},
+	}
+
+	if options.HashDescription {
+		params.Set("descriptionHash", hex.EncodeToString(getDescriptionHash(options.Description)))
+
+	} else {
+		params.Set("description", options.Description)
+	}
+
+	// Eclair adds route hints for private channels on its own
+	if options.FallbackAddr != "" {
+		params.Set("fallbackAddress", options.FallbackAddr)
+	}
+
+	err = eclair.call("createinvoice", params, &response)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return response.Serialized, response.PaymentHash, err
+}
+
+// InvoiceSettled checks if an invoice is settled by looking it up
+func (eclair *Eclair) InvoiceSettled(rHash string) (settled bool, err error) {
+	info, err := eclair.getReceivedInfo(rHash)
+
+	if err != nil {
+		return false, err
+	}
+
+	return info.Status.Type == "received", err
+}
+
+// SubscribeInvoices listens to the websocket of Eclair and calls a callback when an invoice is settled
+func (eclair *Eclair) SubscribeInvoices(publish PublishInvoiceSettled, rescan RescanPendingInvoices) error {
+	config, err := eclair.getWebsocketConfig()
+
+	if err != nil {
+		return err
+	}
+
+	con, err := websocket.DialConfig(config)
+
+	if err != nil {
+		return err
+	}
+
+	defer con.Close()
+
+	// Connected successfully to Eclair
+	// If there are pending invoices after reconnecting they should get rescanned now
+	rescan()
+
+	for {
+		var event eclairEvent
+
+		err = websocket.JSON.Receive(con, &event)
+
+		if err != nil {
+			return err
+		}
+
+		if event.Type == eclairPaymentReceived {
+			// The event does not contain the invoice itself
+			go func(rHash string) {
+				info, err := eclair.getReceivedInfo(rHash)
+
+				if err != nil {
+					log.Warning("Failed to look up settled invoice of Eclair: " + err.Error())
+
+					return
+				}
+
+				publish(SettledInvoice{
+					Invoice: info.PaymentRequest.Serialized,
+					RHash:   rHash,
+				})
+			}(event.PaymentHash)
+		}
+
+	}
+
+}
+
+// KeepAliveRequest is a dummy request to make sure the connection to Eclair works
+func (eclair *Eclair) KeepAliveRequest() error {
+	var response json.RawMessage
+
+	return eclair.call("getinfo", url.Values{}, &response)
+}
+
+func (eclair *Eclair) getReceivedInfo(rHash string) (info eclairReceivedInfo, err error) {
+	err = eclair.call("getreceivedinfo", url.Values{
+		"paymentHash": {rHash},
+	}, &info)
+
+	return info, err
+}
+
+func (eclair *Eclair) getWebsocketConfig() (*websocket.Config, error) {
+	location, err := url.Parse(strings.TrimSuffix(eclair.URL, "/") + "/ws")
+
+	if err != nil {
+		return nil, err
+	}
+
+	origin := *location
+
+	if location.Scheme == "https" {
+		location.Scheme = "wss"
+
+	} else {
+		location.Scheme = "ws"
+	}
+
+	config, err := websocket.NewConfig(location.String(), origin.String())
+
+	if err != nil {
+		return nil, err
+	}
+
+	config.Header.Set("Authorization", eclair.getAuthorization())
+
+	return config, err
+}
+
+// Eclair expects all parameters of its API as form values and uses HTTP basic auth with an empty user
+func (eclair *Eclair) call(method string, params url.Values, result interface{}) error {
+	request, err := http.NewRequest(
+		http.MethodPost,
+		strings.TrimSuffix(eclair.URL, "/")+"/"+method,
+		strings.NewReader(params.Encode()),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", eclair.getAuthorization())
+
+	response, err := eclair.client.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var apiError eclairError
+
+		if json.Unmarshal(data, &apiError) == nil && apiError.Error != "" {
+			return errors.New(apiError.Error)
+		}
+
+		return errors.New("unexpected response status of Eclair API: " + response.Status)
+	}
+
+	return json.Unmarshal(data, result)
+}
+
+func (eclair *Eclair) getAuthorization() string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(":"+eclair.Password))
+}
+
+// AddHoldInvoice is not supported. Eclair has no API for hold invoices
+func (eclair *Eclair) AddHoldInvoice(options InvoiceOptions, paymentHash []byte) (invoice string, err error) {
+	return "", ErrHoldInvoicesNotSupported
+}
+
+// HoldInvoiceAccepted is not supported
+func (eclair *Eclair) HoldInvoiceAccepted(rHash string) (accepted bool, err error) {
+	return false, ErrHoldInvoicesNotSupported
+}
+
+// SettleHoldInvoice is not supported
+func (eclair *Eclair) SettleHoldInvoice(preimage []byte) error {
+	return ErrHoldInvoicesNotSupported
+}
+
+// CancelHoldInvoice is not supported
+func (eclair *Eclair) CancelHoldInvoice(rHash string) error {
+	return ErrHoldInvoicesNotSupported
+}
+
+// PayInvoice pays an invoice and waits for the result
+func (eclair *Eclair) PayInvoice(invoice string, maxFeeMsat int64) (payment Payment, err error) {
+	return eclair.sendPayment("payinvoice", url.Values{
+		"invoice": {invoice},
+	}, maxFeeMsat)
+}
+
+// SendKeysend is not supported because Eclair doesn't wait for the result of keysend payments
+func (eclair *Eclair) SendKeysend(pubkey string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error) {
+	return payment, ErrPaymentsNotSupported
+}
+
+// PayOffer pays an offer and waits for the result
+func (eclair *Eclair) PayOffer(offer string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error) {
+	return eclair.sendPayment("payoffer", url.Values{
+		"offer":      {offer},
+		"amountMsat": {strconv.FormatInt(amountMsat, 10)},
+	}, maxFeeMsat)
+}
+
+// The fee limit of Eclair is in whole satoshis
+func (eclair *Eclair) sendPayment(method string, params url.Values, maxFeeMsat int64) (payment Payment, err error) {
+	params.Set("blocking", "true")
+	params.Set("maxFeeFlatSat", strconv.FormatInt(maxFeeMsat/1000, 10))
+	params.Set("maxFeePct", "0")
+
+	var response eclairPaymentEvent
+
+	err = eclair.call(method, params, &response)
+
+	if err != nil {
+		return payment, err
+	}
+
+	if response.Type == eclairPaymentFailed {
+		return payment, &PaymentFailedError{Reason: "payment failed"}
+	}
+
+	if response.Type != eclairPaymentSent {
+		return payment, errors.New("unexpected result of payment: " + response.Type)
+	}
+
+	payment = Payment{
+		RHash:    response.PaymentHash,
+		Preimage: response.PaymentPreimage,
+	}
+
+	for _, part := range response.Parts {
+		payment.FeeMsat += part.FeesPaid
+	}
+
+	return payment, err
+}
@@ -0,0 +1,283 @@
+package backends
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const eclairTestPassword = "secret"
+
+// Stand-in of the HTTP API of Eclair which records the form values of the last request to every method
+type eclairStub struct {
+	server *httptest.Server
+	params map[string]url.Values
+
+	// Events that are sent to clients of the websocket before it is closed
+	events []eclairEvent
+}
+
+func startEclairStub(t *testing.T) (stub *eclairStub, eclair *Eclair) {
+	stub = &eclairStub{params: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/createinvoice", stub.handle(func(params url.Values) (int, interface{}) {
+		if params.Get("amountMsat") == "0" {
+			return http.StatusBadRequest, eclairError{Error: "amount must be positive"}
+		}
+
+		return http.StatusOK, eclairInvoice{
+			Serialized:  "lnbcrt1eclair",
+			PaymentHash: "aabb",
+		}
+	}))
+
+	mux.HandleFunc("/getreceivedinfo", stub.handle(func(params url.Values) (int, interface{}) {
+		var info eclairReceivedInfo
+
+		info.PaymentRequest.Serialized = "lnbcrt1" + params.Get("paymentHash")
+		info.PaymentRequest.PaymentHash = params.Get("paymentHash")
+
+		switch params.Get("paymentHash") {
+		case "received", "pending", "expired":
+			info.Status.Type = params.Get("paymentHash")
+
+		default:
+			return http.StatusNotFound, eclairError{Error: "Not found"}
+		}
+
+		return http.StatusOK, info
+	}))
+
+	mux.HandleFunc("/getinfo", func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte("The server was not able to produce a timely response"))
+	})
+
+	mux.Handle("/ws", websocket.Handler(func(con *websocket.Conn) {
+		if con.Request().Header.Get("Authorization") != (&Eclair{Password: eclairTestPassword}).getAuthorization() {
+			return
+		}
+
+		for _, event := range stub.events {
+			websocket.JSON.Send(con, event)
+		}
+
+	}))
+
+	stub.server = httptest.NewServer(mux)
+
+	eclair = &Eclair{
+		URL:      stub.server.URL,
+		Password: eclairTestPassword,
+	}
+
+	if err := eclair.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	return stub, eclair
+}
+
+func (stub *eclairStub) handle(handler func(params url.Values) (int, interface{})) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		_, password, ok := request.BasicAuth()
+
+		if !ok || password != eclairTestPassword {
+			writer.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		request.ParseForm()
+
+		stub.params[request.URL.Path] = request.PostForm
+
+		status, response := handler(request.PostForm)
+
+		writer.WriteHeader(status)
+		json.NewEncoder(writer).Encode(response)
+	}
+}
+
+func TestEclairGetInvoice(t *testing.T) {
+	stub, eclair := startEclairStub(t)
+	defer stub.server.Close()
+
+	invoice, rHash, err := eclair.GetInvoice(InvoiceOptions{
+		Description: "tip",
+		AmountMsat:  1500,
+		Expiry:      3600,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if invoice != "lnbcrt1eclair" || rHash != "aabb" {
+		t.Errorf("unexpected invoice %s with hash %s", invoice, rHash)
+	}
+
+	params := stub.params["/createinvoice"]
+
+	if params.Get("amountMsat") != "1500" || params.Get("expireIn") != "3600" || params.Get("description") != "tip" {
+		t.Errorf("unexpected parameters %v", params)
+	}
+
+	if _, ok := params["descriptionHash"]; ok {
+		t.Error("description hash set without being requested")
+	}
+
+	_, _, err = eclair.GetInvoice(InvoiceOptions{
+		Description:     "tip",
+		HashDescription: true,
+		AmountMsat:      1500,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params = stub.params["/createinvoice"]
+
+	if params.Get("descriptionHash") != hex.EncodeToString(getDescriptionHash("tip")) {
+		t.Errorf("unexpected description hash %s", params.Get("descriptionHash"))
+	}
+
+	if _, ok := params["description"]; ok {
+		t.Error("description set although it should be committed to by hash")
+	}
+
+}
+
+func TestEclairInvoiceSettled(t *testing.T) {
+	stub, eclair := startEclairStub(t)
+	defer stub.server.Close()
+
+	expected := map[string]bool{
+		"received": true,
+		"pending":  false,
+		"expired":  false,
+	}
+
+	for status, expectedSettled := range expected {
+		settled, err := eclair.InvoiceSettled(status)
+
+		if err != nil {
+			t.Errorf("unexpected error for status %s: %v", status, err)
+		}
+
+		if settled != expectedSettled {
+			t.Errorf("invoice with status %s settled: %v", status, settled)
+		}
+
+	}
+
+	if _, err := eclair.InvoiceSettled("unknown"); err == nil || err.Error() != "Not found" {
+		t.Errorf("unexpected error for unknown invoice: %v", err)
+	}
+
+}
+
+func TestEclairErrors(t *testing.T) {
+	stub, eclair := startEclairStub(t)
+	defer stub.server.Close()
+
+	// Errors in the body are decoded
+	if _, _, err := eclair.GetInvoice(InvoiceOptions{}); err == nil || err.Error() != "amount must be positive" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Responses without an error message fall back to the status
+	expected := "unexpected response status of Eclair API: 500 Internal Server Error"
+
+	if err := eclair.KeepAliveRequest(); err == nil || err.Error() != expected {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	eclair.Password = "wrong"
+
+	expected = "unexpected response status of Eclair API: 401 Unauthorized"
+
+	if _, err := eclair.InvoiceSettled("received"); err == nil || err.Error() != expected {
+		t.Errorf("unexpected error %v", err)
+	}
+
+}
+
+func TestEclairTimeout(t *testing.T) {
+	previousTimeout := eclairTimeout
+	defer func() { eclairTimeout = previousTimeout }()
+
+	eclairTimeout = 100 * time.Millisecond
+
+	// The stand-in never answers
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-request.Context().Done()
+	}))
+	defer server.Close()
+
+	eclair := &Eclair{URL: server.URL}
+
+	if err := eclair.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := eclair.KeepAliveRequest(); err == nil {
+		t.Error("request to unresponsive API did not time out")
+	}
+
+}
+
+func TestEclairSubscribeInvoices(t *testing.T) {
+	stub, eclair := startEclairStub(t)
+	defer stub.server.Close()
+
+	stub.events = []eclairEvent{
+		{Type: "channel-opened"},
+		{Type: eclairPaymentReceived, PaymentHash: "received"},
+	}
+
+	published := make(chan SettledInvoice, 1)
+	rescanned := false
+
+	err := eclair.SubscribeInvoices(func(settled SettledInvoice) {
+		published <- settled
+	}, func() {
+		rescanned = true
+	})
+
+	// The stub closes the websocket after sending the events
+	if err == nil {
+		t.Error("no error after websocket was closed")
+	}
+
+	if !rescanned {
+		t.Error("pending invoices were not rescanned")
+	}
+
+	select {
+	case settled := <-published:
+		if settled.Invoice != "lnbcrt1received" || settled.RHash != "received" {
+			t.Errorf("unexpected settled invoice %v", settled)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("settled invoice was not published")
+	}
+
+	select {
+	case settled := <-published:
+		t.Errorf("unexpected settled invoice %v", settled)
+
+	case <-time.After(100 * time.Millisecond):
+	}
+
+}
@@ -0,0 +1,535 @@
+package backends
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Failover uses multiple backends at once. Invoices are created on the first healthy backend
+// and all backends are subscribed to so that invoices of any of them are detected as settled
+type Failover struct {
+	ReconnectInterval int64
+
+	lock    sync.RWMutex
+	members []*failoverMember
+
+	// Which backend issued the invoice with a specific payment hash
+	invoices map[string]failoverInvoice
+}
+
+type failoverMember struct {
+	name    string
+	backend Backend
+
+	// Held for writing while the backend reconnects and for reading while it is called. Subscriptions don't
+	// hold it because they block for as long as they run. They are started by the same goroutine that reconnects
+	// after they failed and reconnecting from other goroutines is skipped while the backend is connected
+	lock sync.RWMutex
+
+	connected bool
+	healthy   bool
+}
+
+func (member *failoverMember) call(call func(backend Backend) error) error {
+	member.lock.RLock()
+	defer member.lock.RUnlock()
+
+	return call(member.backend)
+}
+
+// FailoverStatus is the state of one of the backends of Failover
+type FailoverStatus struct {
+	Name      string
+	Connected bool
+	Healthy   bool
+}
+
+type failoverInvoice struct {
+	member *failoverMember
+	expiry time.Time
+}
+
+// How long the issuer of an invoice is remembered after it expired
+const failoverInvoiceRetention = time.Hour
+
+// NewFailover creates a new Failover backend. The order of the backends is the order of preference
+func NewFailover(names []string, backends []Backend, reconnectInterval int64) *Failover {
+	failover := &Failover{
+		ReconnectInterval: reconnectInterval,
+
+		invoices: make(map[string]failoverInvoice),
+	}
+
+	for index, backend := range backends {
+		failover.members = append(failover.members, &failoverMember{
+			name:    names[index],
+			backend: backend,
+		})
+	}
+
+	return failover
+}
+
+// Connect to all backends. Fails only if none of them could be connected to
+func (failover *Failover) Connect() error {
+	var err error
+
+	connected := 0
+
+	for _, member := range failover.members {
+		memberErr := failover.connectMember(member, true)
+
+		failover.setHealthy(member, memberErr == nil)
+
+		if memberErr == nil {
+			connected++
+
+		} else {
+			log.Warning("Failed to connect to backend " + member.name + ": " + memberErr.Error())
+
+			err = memberErr
+		}
+
+	}
+
+	if connected > 0 {
+		return nil
+	}
+
+	return err
+}
+
+// GetInvoice gets an invoice from the first healthy backend
+func (failover *Failover) GetInvoice(options InvoiceOptions) (invoice string, rHash string, err error) {
+	member, err := failover.withCreator(func(backend Backend) (memberErr error) {
+		invoice, rHash, memberErr = backend.GetInvoice(options)
+
+		return memberErr
+	})
+
+	if err != nil {
+		return "", "", err
+	}
+
+	failover.addIssuer(rHash, member, options.Expiry)
+
+	return invoice, rHash, err
+}
+
+// AddHoldInvoice creates a hold invoice on the first healthy backend that supports them
+func (failover *Failover) AddHoldInvoice(options InvoiceOptions, paymentHash []byte) (invoice string, err error) {
+	member, err := failover.withCreator(func(backend Backend) (memberErr error) {
+		invoice, memberErr = backend.AddHoldInvoice(options, paymentHash)
+
+		return memberErr
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	failover.addIssuer(hex.EncodeToString(paymentHash), member, options.Expiry)
+
+	return invoice, err
+}
+
+// Calls the function with the healthy backends in the order of preference until it succeeds for one of them
+// Backends for which it fails are marked as unhealthy. If no healthy backend is left the other connected ones
+// are tried as last resort and become healthy again if it succeeds for them
+func (failover *Failover) withCreator(call func(backend Backend) error) (*failoverMember, error) {
+	err := errors.New("no healthy backend available")
+
+	for _, member := range failover.getCreatorCandidates() {
+		memberErr := member.call(call)
+
+		if memberErr == nil {
+			if !failover.isHealthy(member) {
+				log.Info("Backend " + member.name + " is healthy again")
+
+				failover.setHealthy(member, true)
+			}
+
+			return member, nil
+		}
+
+		err = memberErr
+
+		// Not supporting hold invoices doesn't make a backend unhealthy
+		if memberErr == ErrHoldInvoicesNotSupported {
+			continue
+		}
+
+		if failover.isHealthy(member) {
+			log.Warning("Backend " + member.name + " is unhealthy because it failed to create an invoice: " + memberErr.Error())
+
+			failover.setHealthy(member, false)
+		}
+
+	}
+
+	return nil, err
+}
+
+// HoldInvoiceAccepted asks the backend that issued the hold invoice whether it was accepted
+func (failover *Failover) HoldInvoiceAccepted(rHash string) (accepted bool, err error) {
+	err = failover.withIssuer(rHash, func(backend Backend) (memberErr error) {
+		accepted, memberErr = backend.HoldInvoiceAccepted(rHash)
+
+		return memberErr
+	})
+
+	return accepted, err
+}
+
+// SettleHoldInvoice settles a hold invoice on the backend that issued it
+func (failover *Failover) SettleHoldInvoice(preimage []byte) error {
+	paymentHash := sha256.Sum256(preimage)
+
+	return failover.withIssuer(hex.EncodeToString(paymentHash[:]), func(backend Backend) error {
+		return backend.SettleHoldInvoice(preimage)
+	})
+}
+
+// CancelHoldInvoice cancels a hold invoice on the backend that issued it
+func (failover *Failover) CancelHoldInvoice(rHash string) error {
+	return failover.withIssuer(rHash, func(backend Backend) error {
+		return backend.CancelHoldInvoice(rHash)
+	})
+}
+
+// PayInvoice pays an invoice with the first healthy backend that supports it
+func (failover *Failover) PayInvoice(invoice string, maxFeeMsat int64) (payment Payment, err error) {
+	err = failover.withPayer(func(backend Backend) (memberErr error) {
+		payment, memberErr = backend.PayInvoice(invoice, maxFeeMsat)
+
+		return memberErr
+	})
+
+	return payment, err
+}
+
+// SendKeysend sends a keysend payment with the first healthy backend that supports it
+func (failover *Failover) SendKeysend(pubkey string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error) {
+	err = failover.withPayer(func(backend Backend) (memberErr error) {
+		payment, memberErr = backend.SendKeysend(pubkey, amountMsat, maxFeeMsat)
+
+		return memberErr
+	})
+
+	return payment, err
+}
+
+// PayOffer pays an offer with the first healthy backend that supports it
+func (failover *Failover) PayOffer(offer string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error) {
+	err = failover.withPayer(func(backend Backend) (memberErr error) {
+		payment, memberErr = backend.PayOffer(offer, amountMsat, maxFeeMsat)
+
+		return memberErr
+	})
+
+	return payment, err
+}
+
+// Calls the function with the healthy backends in the order of preference until one of them supports the payment
+// Other errors are returned right away because the payment might have been sent partially
+func (failover *Failover) withPayer(call func(backend Backend) error) error {
+	err := errors.New("no healthy backend available")
+
+	for _, member := range failover.members {
+		if !failover.isHealthy(member) {
+			continue
+		}
+
+		if err = member.call(call); err != ErrPaymentsNotSupported {
+			return err
+		}
+
+	}
+
+	return err
+}
+
+func (failover *Failover) addIssuer(rHash string, member *failoverMember, expiry int64) {
+	now := time.Now()
+
+	failover.lock.Lock()
+	defer failover.lock.Unlock()
+
+	// Forget about invoices that expired a while ago
+	for paymentHash, issued := range failover.invoices {
+		if now.Sub(issued.expiry) > failoverInvoiceRetention {
+			delete(failover.invoices, paymentHash)
+		}
+	}
+
+	failover.invoices[rHash] = failoverInvoice{
+		member: member,
+		expiry: now.Add(time.Duration(expiry) * time.Second),
+	}
+}
+
+// Calls the function with the backend that issued the invoice. If the issuer is unknown, because LightningTip
+// was restarted for example, it is called with all connected backends until it succeeds for one of them
+func (failover *Failover) withIssuer(rHash string, call func(backend Backend) error) error {
+	failover.lock.RLock()
+
+	issued, ok := failover.invoices[rHash]
+
+	failover.lock.RUnlock()
+
+	if ok {
+		return issued.member.call(call)
+	}
+
+	err := errors.New("no connected backend available")
+
+	for _, member := range failover.members {
+		if !failover.isConnected(member) {
+			continue
+		}
+
+		if err = member.call(call); err == nil {
+			return nil
+		}
+
+	}
+
+	return err
+}
+
+// InvoiceSettled asks the backend that issued the invoice whether it is settled. If the issuer is unknown
+// all backends are asked
+func (failover *Failover) InvoiceSettled(rHash string) (settled bool, err error) {
+	failover.lock.RLock()
+
+	issued, ok := failover.invoices[rHash]
+
+	failover.lock.RUnlock()
+
+	if ok {
+		err = issued.member.call(func(backend Backend) (memberErr error) {
+			settled, memberErr = backend.InvoiceSettled(rHash)
+
+			return memberErr
+		})
+
+		return settled, err
+	}
+
+	err = errors.New("no connected backend available")
+
+	for _, member := range failover.members {
+		if !failover.isConnected(member) {
+			continue
+		}
+
+		var memberSettled bool
+
+		memberErr := member.call(func(backend Backend) (callErr error) {
+			memberSettled, callErr = backend.InvoiceSettled(rHash)
+
+			return callErr
+		})
+
+		if memberErr == nil {
+			if memberSettled {
+				return true, nil
+			}
+
+			err = nil
+
+		} else if err != nil {
+			err = memberErr
+		}
+
+	}
+
+	return false, err
+}
+
+// SubscribeInvoices subscribes to the invoices of all backends. Subscriptions that fail get reestablished
+// at the reconnect interval. An error is returned when all subscriptions failed and reconnecting is disabled
+func (failover *Failover) SubscribeInvoices(publish PublishInvoiceSettled, rescan RescanPendingInvoices) error {
+	var wait sync.WaitGroup
+
+	for _, member := range failover.members {
+		wait.Add(1)
+
+		go func(member *failoverMember) {
+			defer wait.Done()
+
+			for {
+				var err error
+
+				if !failover.isConnected(member) {
+					err = failover.connectMember(member, false)
+				}
+
+				if err == nil {
+					err = member.backend.SubscribeInvoices(publish, func() {
+						failover.setHealthy(member, true)
+
+						rescan()
+					})
+				}
+
+				failover.setHealthy(member, false)
+
+				log.Warning("Lost subscription to invoices of backend " + member.name + ": " + fmt.Sprint(err))
+
+				if failover.ReconnectInterval == 0 {
+					return
+				}
+
+				time.Sleep(time.Duration(failover.ReconnectInterval) * time.Second)
+
+				log.Info("Trying to reconnect to backend " + member.name)
+
+				err = failover.connectMember(member, true)
+
+				if err != nil {
+					log.Debug("Failed to reconnect to backend " + member.name + ": " + err.Error())
+				}
+
+			}
+
+		}(member)
+	}
+
+	wait.Wait()
+
+	return errors.New("lost subscriptions to all backends")
+}
+
+// KeepAliveRequest sends a keep alive request to all backends and uses the result to decide which backends are healthy
+func (failover *Failover) KeepAliveRequest() error {
+	var err error
+
+	healthy := 0
+
+	for _, member := range failover.members {
+		var memberErr error
+
+		if !failover.isConnected(member) {
+			memberErr = failover.connectMember(member, false)
+		}
+
+		if memberErr == nil {
+			memberErr = member.call(func(backend Backend) error {
+				return backend.KeepAliveRequest()
+			})
+		}
+
+		// The default macaroon of LND doesn't allow the keep alive request but a denied request still
+		// shows that the connection works
+		if memberErr != nil && !strings.Contains(memberErr.Error(), "permission denied") {
+			if failover.isHealthy(member) {
+				log.Warning("Backend " + member.name + " is unhealthy: " + memberErr.Error())
+			}
+
+			failover.setHealthy(member, false)
+
+			err = memberErr
+
+		} else {
+			if !failover.isHealthy(member) {
+				log.Info("Backend " + member.name + " is healthy again")
+			}
+
+			failover.setHealthy(member, true)
+
+			healthy++
+		}
+
+	}
+
+	if healthy > 0 {
+		return nil
+	}
+
+	return err
+}
+
+// Statuses returns the state of all backends in the order of preference
+func (failover *Failover) Statuses() (statuses []FailoverStatus) {
+	failover.lock.RLock()
+	defer failover.lock.RUnlock()
+
+	for _, member := range failover.members {
+		statuses = append(statuses, FailoverStatus{
+			Name:      member.name,
+			Connected: member.connected,
+			Healthy:   member.healthy,
+		})
+	}
+
+	return statuses
+}
+
+// The healthy backends in the order of preference followed by the connected unhealthy ones
+func (failover *Failover) getCreatorCandidates() (candidates []*failoverMember) {
+	failover.lock.RLock()
+	defer failover.lock.RUnlock()
+
+	var unhealthy []*failoverMember
+
+	for _, member := range failover.members {
+		if member.healthy {
+			candidates = append(candidates, member)
+
+		} else if member.connected {
+			unhealthy = append(unhealthy, member)
+		}
+
+	}
+
+	return append(candidates, unhealthy...)
+}
+
+// Backends are reconnected to either because they are not connected or, if force is set, because their
+// subscription failed. The check whether they are connected is repeated with the lock held because the
+// subscription and the keep alive requests can try to reconnect at the same time
+func (failover *Failover) connectMember(member *failoverMember, force bool) error {
+	member.lock.Lock()
+	defer member.lock.Unlock()
+
+	if !force && failover.isConnected(member) {
+		return nil
+	}
+
+	err := member.backend.Connect()
+
+	failover.lock.Lock()
+
+	member.connected = err == nil
+
+	failover.lock.Unlock()
+
+	return err
+}
+
+func (failover *Failover) isConnected(member *failoverMember) bool {
+	failover.lock.RLock()
+	defer failover.lock.RUnlock()
+
+	return member.connected
+}
+
+func (failover *Failover) isHealthy(member *failoverMember) bool {
+	failover.lock.RLock()
+	defer failover.lock.RUnlock()
+
+	return member.healthy
+}
+
+func (failover *Failover) setHealthy(member *failoverMember, healthy bool) {
+	failover.lock.Lock()
+	defer failover.lock.Unlock()
+
+	member.healthy = healthy
+}
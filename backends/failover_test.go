@@ -0,0 +1,113 @@
+package backends
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// A backend that is connected but can't create invoices
+type brokenBackend struct {
+	Mock
+}
+
+func (broken *brokenBackend) GetInvoice(options InvoiceOptions) (invoice string, rHash string, err error) {
+	return "", "", errors.New("node is down")
+}
+
+// A backend that counts how often it was connected to
+type countingBackend struct {
+	Mock
+
+	connects int
+}
+
+func (counting *countingBackend) Connect() error {
+	counting.connects++
+
+	return counting.Mock.Connect()
+}
+
+func TestFailoverGetInvoice(t *testing.T) {
+	broken := &brokenBackend{}
+	working := &Mock{}
+
+	failover := NewFailover([]string{"broken", "working"}, []Backend{broken, working}, 0)
+
+	if err := failover.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, rHash, err := failover.GetInvoice(InvoiceOptions{AmountMsat: 1000, Expiry: 60})
+
+	if err != nil {
+		t.Fatalf("invoice was not created by the next backend: %v", err)
+	}
+
+	if _, ok := working.invoices[rHash]; !ok {
+		t.Error("invoice was not created by the working backend")
+	}
+
+	statuses := failover.Statuses()
+
+	if statuses[0].Healthy || !statuses[1].Healthy {
+		t.Errorf("unexpected health of backends %v", statuses)
+	}
+
+	// The unhealthy backend must not be asked again while a healthy one is left
+	if _, _, err = failover.GetInvoice(InvoiceOptions{AmountMsat: 1000, Expiry: 60}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without healthy backends the connected ones are tried as last resort
+	failover.setHealthy(failover.members[1], false)
+
+	if _, _, err = failover.GetInvoice(InvoiceOptions{AmountMsat: 1000, Expiry: 60}); err != nil {
+		t.Fatalf("connected backend was not tried as last resort: %v", err)
+	}
+
+	if statuses = failover.Statuses(); !statuses[1].Healthy {
+		t.Error("backend did not become healthy again after it created an invoice")
+	}
+
+	// The error of the last backend is returned if all of them fail
+	failover.members = failover.members[:1]
+
+	if _, _, err = failover.GetInvoice(InvoiceOptions{AmountMsat: 1000}); err == nil || err.Error() != "node is down" {
+		t.Errorf("unexpected error when all backends fail: %v", err)
+	}
+
+}
+
+func TestFailoverConnectMember(t *testing.T) {
+	counting := &countingBackend{}
+
+	failover := NewFailover([]string{"counting"}, []Backend{counting}, 0)
+	member := failover.members[0]
+
+	var wait sync.WaitGroup
+
+	// The keep alive requests and the subscription may try to reconnect at the same time
+	for i := 0; i < 10; i++ {
+		wait.Add(2)
+
+		go func() {
+			defer wait.Done()
+
+			failover.connectMember(member, false)
+		}()
+
+		go func() {
+			defer wait.Done()
+
+			failover.KeepAliveRequest()
+		}()
+	}
+
+	wait.Wait()
+
+	if counting.connects != 1 {
+		t.Errorf("backend was connected to %d times instead of once", counting.connects)
+	}
+
+}
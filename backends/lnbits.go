@@ -0,0 +1,294 @@
+package backends
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LNbits contains all values needed to be able to use a LNbits wallet
+type LNbits struct {
+	URL        string `long:"url" Description:"URL of the LNbits instance"`
+	InvoiceKey string `long:"invoicekey" Description:"Invoice/read key of the LNbits wallet"`
+
+	client       *http.Client
+	streamClient *http.Client
+}
+
+// Requests to the API are aborted after this. The Server-Sent Events stream stays open for longer
+var lnbitsTimeout = 30 * time.Second
+
+type lnbitsError struct {
+	Detail string `json:"detail"`
+}
+
+type lnbitsCreateInvoice struct {
+	Out             bool   `json:"out"`
+	Amount          int64  `json:"amount"`
+	Memo            string `json:"memo"`
+	DescriptionHash string `json:"description_hash,omitempty"`
+	Expiry          int64  `json:"expiry"`
+}
+
+type lnbitsInvoice struct {
+	PaymentHash    string `json:"payment_hash"`
+	PaymentRequest string `json:"payment_request"`
+}
+
+type lnbitsPaymentStatus struct {
+	Paid bool `json:"paid"`
+}
+
+type lnbitsPayment struct {
+	PaymentHash string `json:"payment_hash"`
+	Bolt11      string `json:"bolt11"`
+	Pending     bool   `json:"pending"`
+}
+
+const lnbitsPaymentReceived = "payment-received"
+
+// Connect to a LNbits instance
+func (lnbits *LNbits) Connect() error {
+	// There is no default instance because the invoice key would be sent to whoever runs it
+	if lnbits.URL == "" || lnbits.InvoiceKey == "" {
+		log.Error("URL and invoice key of LNbits have to be set")
+
+		return errors.New("URL or invoice key of LNbits not set")
+	}
+
+	_, err := url.Parse(lnbits.URL)
+
+	if err != nil {
+		log.Error("Failed to parse URL of LNbits")
+
+		return err
+	}
+
+	lnbits.client = &http.Client{
+		Timeout: lnbitsTimeout,
+	}
+
+	lnbits.streamClient = &http.Client{}
+
+	return err
+}
+
+// GetInvoice gets and invoice from the wallet
+func (lnbits *LNbits) GetInvoice(options InvoiceOptions) (invoice string, rHash string, err error) {
+	// The API of LNbits accepts only whole satoshis
+	if options.AmountMsat%1000 != 0 {
+		return "", "", errFractionalSatoshis
+	}
+
+	request := lnbitsCreateInvoice{
+		Out:    false,
+		Amount: options.AmountMsat / 1000,
+		Memo:   options.Description,
+		Expiry: options.Expiry,
+	}
+
+	// The memo is still shown in the wallet but not put into the invoice
+	if options.HashDescription {
+		request.DescriptionHash = hex.EncodeToString(getDescriptionHash(options.Description))
+	}
+
+	var response lnbitsInvoice
+
+	err = lnbits.call(http.MethodPost, "/api/v1/payments", request, &response)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return response.PaymentRequest, response.PaymentHash, err
+}
+
+// InvoiceSettled checks if an invoice is settled by looking it up
+func (lnbits *LNbits) InvoiceSettled(rHash string) (settled bool, err error) {
+	var response lnbitsPaymentStatus
+
+	err = lnbits.call(http.MethodGet, "/api/v1/payments/"+url.PathEscape(rHash), nil, &response)
+
+	if err != nil {
+		return false, err
+	}
+
+	return response.Paid, err
+}
+
+// SubscribeInvoices listens to the Server-Sent Events stream of the wallet and calls a callback when an invoice is settled
+func (lnbits *LNbits) SubscribeInvoices(publish PublishInvoiceSettled, rescan RescanPendingInvoices) error {
+	response, err := lnbits.request(lnbits.streamClient, http.MethodGet, "/api/v1/payments/sse", nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	// Connected successfully to LNbits
+	// If there are pending invoices after reconnecting they should get rescanned now
+	rescan()
+
+	scanner := bufio.NewScanner(response.Body)
+
+	var event string
+	var data string
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		// An empty line terminates an event
+		case line == "":
+			if event == lnbitsPaymentReceived {
+				var payment lnbitsPayment
+
+				if err := json.Unmarshal([]byte(data), &payment); err == nil {
+					if !payment.Pending {
+						go publish(SettledInvoice{
+							Invoice: payment.Bolt11,
+							RHash:   payment.PaymentHash,
+						})
+					}
+
+				} else {
+					log.Warning("Failed to parse event of LNbits: " + err.Error())
+				}
+
+			}
+
+			event = ""
+			data = ""
+
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+
+	}
+
+	err = scanner.Err()
+
+	if err == nil {
+		err = errors.New("lost connection to LNbits")
+	}
+
+	return err
+}
+
+// KeepAliveRequest is a dummy request to make sure the connection to LNbits works
+func (lnbits *LNbits) KeepAliveRequest() error {
+	var response json.RawMessage
+
+	return lnbits.call(http.MethodGet, "/api/v1/wallet", nil, &response)
+}
+
+func (lnbits *LNbits) call(method string, path string, body interface{}, result interface{}) error {
+	response, err := lnbits.request(lnbits.client, method, path, body)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, result)
+}
+
+// The caller has to close the body of the response if no error is returned
+func (lnbits *LNbits) request(client *http.Client, method string, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequest(method, strings.TrimSuffix(lnbits.URL, "/")+path, reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Api-Key", lnbits.InvoiceKey)
+
+	response, err := client.Do(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		defer response.Body.Close()
+
+		var apiError lnbitsError
+
+		data, _ := ioutil.ReadAll(response.Body)
+
+		if json.Unmarshal(data, &apiError) == nil && apiError.Detail != "" {
+			return nil, errors.New(apiError.Detail)
+		}
+
+		return nil, errors.New("unexpected response status of LNbits: " + response.Status)
+	}
+
+	return response, err
+}
+
+// AddHoldInvoice is not supported. The API of LNbits has no hold invoices
+func (lnbits *LNbits) AddHoldInvoice(options InvoiceOptions, paymentHash []byte) (invoice string, err error) {
+	return "", ErrHoldInvoicesNotSupported
+}
+
+// HoldInvoiceAccepted is not supported
+func (lnbits *LNbits) HoldInvoiceAccepted(rHash string) (accepted bool, err error) {
+	return false, ErrHoldInvoicesNotSupported
+}
+
+// SettleHoldInvoice is not supported
+func (lnbits *LNbits) SettleHoldInvoice(preimage []byte) error {
+	return ErrHoldInvoicesNotSupported
+}
+
+// CancelHoldInvoice is not supported
+func (lnbits *LNbits) CancelHoldInvoice(rHash string) error {
+	return ErrHoldInvoicesNotSupported
+}
+
+// PayInvoice is not supported because LightningTip only has the invoice key of the wallet
+func (lnbits *LNbits) PayInvoice(invoice string, maxFeeMsat int64) (payment Payment, err error) {
+	return payment, ErrPaymentsNotSupported
+}
+
+// SendKeysend is not supported
+func (lnbits *LNbits) SendKeysend(pubkey string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error) {
+	return payment, ErrPaymentsNotSupported
+}
+
+// PayOffer is not supported
+func (lnbits *LNbits) PayOffer(offer string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error) {
+	return payment, ErrPaymentsNotSupported
+}
@@ -0,0 +1,253 @@
+package backends
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const lnbitsTestKey = "invoicekey"
+
+// The payment-received events of the Server-Sent Events stream of the stand-in. Data that spans multiple
+// lines is split into multiple "data:" fields
+const lnbitsTestStream = "event: payment-received\n" +
+	"data: {\"payment_hash\": \"pending\", \"bolt11\": \"lnbc1pending\", \"pending\": true}\n" +
+	"\n" +
+	": keepalive comment\n" +
+	"\n" +
+	"event: payment-received\n" +
+	"data: {\"payment_hash\": \"paid\",\n" +
+	"data:  \"bolt11\": \"lnbc1paid\",\n" +
+	"data:  \"pending\": false}\n" +
+	"\n" +
+	"event: other\n" +
+	"data: {\"payment_hash\": \"other\", \"pending\": false}\n" +
+	"\n"
+
+func startLNbitsStub(t *testing.T) (server *httptest.Server, lnbits *LNbits, created *lnbitsCreateInvoice) {
+	created = &lnbitsCreateInvoice{}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/v1/payments", func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost {
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		if err := json.NewDecoder(request.Body).Decode(created); err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		writer.WriteHeader(http.StatusCreated)
+
+		json.NewEncoder(writer).Encode(lnbitsInvoice{
+			PaymentHash:    "aabb",
+			PaymentRequest: "lnbc1lnbits",
+		})
+	})
+
+	mux.HandleFunc("/api/v1/payments/", func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/api/v1/payments/paid":
+			json.NewEncoder(writer).Encode(lnbitsPaymentStatus{Paid: true})
+
+		case "/api/v1/payments/unpaid":
+			json.NewEncoder(writer).Encode(lnbitsPaymentStatus{Paid: false})
+
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+
+			json.NewEncoder(writer).Encode(lnbitsError{Detail: "Payment does not exist."})
+		}
+
+	})
+
+	mux.HandleFunc("/api/v1/payments/sse", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/event-stream")
+
+		// The stream ends after all events were sent
+		writer.Write([]byte(lnbitsTestStream))
+	})
+
+	server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("X-Api-Key") != lnbitsTestKey {
+			writer.WriteHeader(http.StatusUnauthorized)
+
+			json.NewEncoder(writer).Encode(lnbitsError{Detail: "Invalid key"})
+
+			return
+		}
+
+		mux.ServeHTTP(writer, request)
+	}))
+
+	lnbits = &LNbits{
+		URL:        server.URL + "/",
+		InvoiceKey: lnbitsTestKey,
+	}
+
+	if err := lnbits.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	return server, lnbits, created
+}
+
+func TestLNbitsGetInvoice(t *testing.T) {
+	server, lnbits, created := startLNbitsStub(t)
+	defer server.Close()
+
+	invoice, rHash, err := lnbits.GetInvoice(InvoiceOptions{
+		Description:     "tip",
+		HashDescription: true,
+		AmountMsat:      21000,
+		Expiry:          3600,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if invoice != "lnbc1lnbits" || rHash != "aabb" {
+		t.Errorf("unexpected invoice %s with hash %s", invoice, rHash)
+	}
+
+	if created.Out || created.Amount != 21 || created.Memo != "tip" || created.Expiry != 3600 {
+		t.Errorf("unexpected request %+v", created)
+	}
+
+	if created.DescriptionHash == "" {
+		t.Error("description was not committed to by hash")
+	}
+
+	if _, _, err := lnbits.GetInvoice(InvoiceOptions{AmountMsat: 1500}); err != errFractionalSatoshis {
+		t.Errorf("unexpected error for fractional satoshis: %v", err)
+	}
+
+	lnbits.InvoiceKey = "wrong"
+
+	if _, _, err := lnbits.GetInvoice(InvoiceOptions{AmountMsat: 1000}); err == nil || err.Error() != "Invalid key" {
+		t.Errorf("unexpected error for wrong key: %v", err)
+	}
+
+}
+
+func TestLNbitsInvoiceSettled(t *testing.T) {
+	server, lnbits, _ := startLNbitsStub(t)
+	defer server.Close()
+
+	if settled, err := lnbits.InvoiceSettled("paid"); err != nil || !settled {
+		t.Errorf("paid invoice is not settled: %v", err)
+	}
+
+	if settled, err := lnbits.InvoiceSettled("unpaid"); err != nil || settled {
+		t.Errorf("unpaid invoice is settled: %v", err)
+	}
+
+	if _, err := lnbits.InvoiceSettled("unknown"); err == nil || err.Error() != "Payment does not exist." {
+		t.Errorf("unexpected error for unknown invoice: %v", err)
+	}
+
+}
+
+func TestLNbitsSubscribeInvoices(t *testing.T) {
+	server, lnbits, _ := startLNbitsStub(t)
+	defer server.Close()
+
+	published := make(chan SettledInvoice, 3)
+	rescanned := false
+
+	err := lnbits.SubscribeInvoices(func(settled SettledInvoice) {
+		published <- settled
+	}, func() {
+		rescanned = true
+	})
+
+	if err == nil || err.Error() != "lost connection to LNbits" {
+		t.Errorf("unexpected error at the end of the stream: %v", err)
+	}
+
+	if !rescanned {
+		t.Error("pending invoices were not rescanned")
+	}
+
+	select {
+	case settled := <-published:
+		if settled.Invoice != "lnbc1paid" || settled.RHash != "paid" {
+			t.Errorf("unexpected settled invoice %v", settled)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("settled invoice was not published")
+	}
+
+	// Pending payments and other events must be ignored
+	select {
+	case settled := <-published:
+		t.Errorf("unexpected settled invoice %v", settled)
+
+	case <-time.After(100 * time.Millisecond):
+	}
+
+}
+
+func TestLNbitsTimeout(t *testing.T) {
+	previousTimeout := lnbitsTimeout
+	defer func() { lnbitsTimeout = previousTimeout }()
+
+	lnbitsTimeout = 100 * time.Millisecond
+
+	// The stand-in never answers requests to the API but the stream sends an event after the timeout
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/api/v1/payments/sse" {
+			<-request.Context().Done()
+
+			return
+		}
+
+		writer.Header().Set("Content-Type", "text/event-stream")
+		writer.Write([]byte(": keepalive comment\n\n"))
+		writer.(http.Flusher).Flush()
+
+		time.Sleep(3 * lnbitsTimeout)
+
+		writer.Write([]byte("event: payment-received\ndata: {\"payment_hash\": \"paid\", \"bolt11\": \"lnbc1paid\"}\n\n"))
+	}))
+	defer server.Close()
+
+	lnbits := &LNbits{
+		URL:        server.URL,
+		InvoiceKey: lnbitsTestKey,
+	}
+
+	if err := lnbits.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lnbits.KeepAliveRequest(); err == nil {
+		t.Error("request to unresponsive API did not time out")
+	}
+
+	published := make(chan SettledInvoice, 1)
+
+	lnbits.SubscribeInvoices(func(settled SettledInvoice) {
+		published <- settled
+	}, func() {})
+
+	select {
+	case settled := <-published:
+		if settled.RHash != "paid" {
+			t.Errorf("unexpected settled invoice %v", settled)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream was aborted by the timeout of the API requests")
+	}
+
+}
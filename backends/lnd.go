@@ -2,12 +2,14 @@ package backends
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"io"
 	"io/ioutil"
 
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
@@ -19,8 +21,10 @@ type LND struct {
 	CertFile     string `long:"certfile" Description:"TLS certificate for the LND gRPC and REST services"`
 	MacaroonFile string `long:"macaroonfile" Description:"Macaroon file for authentication. Set to an empty string for no macaroon"`
 
-	ctx    context.Context
-	client lnrpc.LightningClient
+	ctx      context.Context
+	con      *grpc.ClientConn
+	client   lnrpc.LightningClient
+	invoices invoicesrpc.InvoicesClient
 }
 
 // Connect to a node
@@ -58,20 +62,36 @@ func (lnd *LND) Connect() error {
 
 	}
 
+	// The connection of a previous call would leak otherwise when reconnecting
+	if lnd.con != nil {
+		lnd.con.Close()
+	}
+
+	lnd.con = con
 	lnd.client = lnrpc.NewLightningClient(con)
+	lnd.invoices = invoicesrpc.NewInvoicesClient(con)
 
 	return err
 }
 
 // GetInvoice gets and invoice from a node
-func (lnd *LND) GetInvoice(message string, amount int64, expiry int64) (invoice string, rHash string, err error) {
+func (lnd *LND) GetInvoice(options InvoiceOptions) (invoice string, rHash string, err error) {
 	var response *lnrpc.AddInvoiceResponse
 
-	response, err = lnd.client.AddInvoice(lnd.ctx, &lnrpc.Invoice{
-		Memo:   message,
-		Value:  amount,
-		Expiry: expiry,
-	})
+	request := &lnrpc.Invoice{
+		Memo:         options.Description,
+		ValueMsat:    options.AmountMsat,
+		Expiry:       options.Expiry,
+		Private:      options.Private,
+		FallbackAddr: options.FallbackAddr,
+	}
+
+	if options.HashDescription {
+		request.Memo = ""
+		request.DescriptionHash = getDescriptionHash(options.Description)
+	}
+
+	response, err = lnd.client.AddInvoice(lnd.ctx, request)
 
 	if err != nil {
 		return "", "", err
@@ -85,7 +105,7 @@ func (lnd *LND) InvoiceSettled(rHash string) (settled bool, err error) {
 	var invoice *lnrpc.Invoice
 
 	rpcPaymentHash := lnrpc.PaymentHash{
-		RHash: []byte(rHash),
+		RHashStr: rHash,
 	}
 
 	invoice, err = lnd.client.LookupInvoice(lnd.ctx, &rpcPaymentHash)
@@ -94,12 +114,17 @@ func (lnd *LND) InvoiceSettled(rHash string) (settled bool, err error) {
 		return false, err
 	}
 
-	return invoice.Settled, err
+	return invoice.State == lnrpc.Invoice_SETTLED, err
 }
 
 // SubscribeInvoices subscribe to the invoice events of LND and calls a callback when one is settled
+// Invoices that were settled after the last settle index that got processed are replayed
 func (lnd *LND) SubscribeInvoices(publish PublishInvoiceSettled, rescan RescanPendingInvoices) error {
-	stream, err := lnd.client.SubscribeInvoices(lnd.ctx, &lnrpc.InvoiceSubscription{})
+	settleIndexKey := "lnd:" + lnd.GRPCHost
+
+	stream, err := lnd.client.SubscribeInvoices(lnd.ctx, &lnrpc.InvoiceSubscription{
+		SettleIndex: getSettleIndex(settleIndexKey),
+	})
 
 	if err != nil {
 		return err
@@ -127,8 +152,11 @@ func (lnd *LND) SubscribeInvoices(publish PublishInvoiceSettled, rescan RescanPe
 				return
 			}
 
-			if invoice.Settled {
-				go publish(invoice.PaymentRequest)
+			if invoice.State == lnrpc.Invoice_SETTLED {
+				// The settle index is stored after the invoice was processed to make sure it is not lost
+				publish(toSettledInvoice(invoice))
+
+				setSettleIndex(settleIndexKey, invoice.SettleIndex)
 			}
 
 		}
@@ -144,6 +172,30 @@ func (lnd *LND) SubscribeInvoices(publish PublishInvoiceSettled, rescan RescanPe
 	return err
 }
 
+// AMP invoices can be created with a payment request too. Only the ones without one were paid spontaneously
+func toSettledInvoice(invoice *lnrpc.Invoice) SettledInvoice {
+	settled := SettledInvoice{
+		Invoice: invoice.PaymentRequest,
+		RHash:   hex.EncodeToString(invoice.RHash),
+	}
+
+	if invoice.PaymentRequest == "" && (invoice.IsKeysend || invoice.IsAmp) {
+		settled.Keysend = true
+		settled.AmountMsat = invoice.AmtPaidMsat
+
+		for _, htlc := range invoice.Htlcs {
+			if message, ok := htlc.CustomRecords[keysendMessageRecord]; ok {
+				settled.Message = string(message)
+
+				break
+			}
+		}
+
+	}
+
+	return settled
+}
+
 // KeepAliveRequest is a dummy request to make sure the connection to LND doesn't time out if
 // LND and LightningTip are separated with a firewall
 func (lnd *LND) KeepAliveRequest() error {
@@ -161,3 +213,137 @@ func getMacaroon(macaroonFile string) (macaroon metadata.MD, err error) {
 
 	return macaroon, err
 }
+
+// AddHoldInvoice creates a hold invoice with the invoices sub-server of LND
+func (lnd *LND) AddHoldInvoice(options InvoiceOptions, paymentHash []byte) (invoice string, err error) {
+	request := &invoicesrpc.AddHoldInvoiceRequest{
+		Memo:         options.Description,
+		Hash:         paymentHash,
+		ValueMsat:    options.AmountMsat,
+		Expiry:       options.Expiry,
+		Private:      options.Private,
+		FallbackAddr: options.FallbackAddr,
+	}
+
+	if options.HashDescription {
+		request.Memo = ""
+		request.DescriptionHash = getDescriptionHash(options.Description)
+	}
+
+	response, err := lnd.invoices.AddHoldInvoice(lnd.ctx, request)
+
+	if err != nil {
+		return "", err
+	}
+
+	return response.PaymentRequest, err
+}
+
+// HoldInvoiceAccepted checks whether a hold invoice was paid by looking it up
+func (lnd *LND) HoldInvoiceAccepted(rHash string) (accepted bool, err error) {
+	invoice, err := lnd.client.LookupInvoice(lnd.ctx, &lnrpc.PaymentHash{
+		RHashStr: rHash,
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return invoice.State == lnrpc.Invoice_ACCEPTED, err
+}
+
+// SettleHoldInvoice settles a hold invoice that was accepted
+func (lnd *LND) SettleHoldInvoice(preimage []byte) error {
+	_, err := lnd.invoices.SettleInvoice(lnd.ctx, &invoicesrpc.SettleInvoiceMsg{
+		Preimage: preimage,
+	})
+
+	return err
+}
+
+// CancelHoldInvoice cancels a hold invoice and refunds the payer if it was accepted already
+func (lnd *LND) CancelHoldInvoice(rHash string) error {
+	paymentHash, err := hex.DecodeString(rHash)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = lnd.invoices.CancelInvoice(lnd.ctx, &invoicesrpc.CancelInvoiceMsg{
+		PaymentHash: paymentHash,
+	})
+
+	return err
+}
+
+// PayInvoice pays an invoice. The macaroon needs the permission to send payments
+func (lnd *LND) PayInvoice(invoice string, maxFeeMsat int64) (payment Payment, err error) {
+	return lnd.sendPayment(&lnrpc.SendRequest{
+		PaymentRequest: invoice,
+		FeeLimit: &lnrpc.FeeLimit{
+			Limit: &lnrpc.FeeLimit_FixedMsat{
+				FixedMsat: maxFeeMsat,
+			},
+		},
+	})
+}
+
+// SendKeysend sends a spontaneous payment with a random preimage
+func (lnd *LND) SendKeysend(pubkey string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error) {
+	dest, err := hex.DecodeString(pubkey)
+
+	if err != nil {
+		return payment, err
+	}
+
+	preimage, paymentHash, err := newPreimage()
+
+	if err != nil {
+		return payment, err
+	}
+
+	return lnd.sendPayment(&lnrpc.SendRequest{
+		Dest:        dest,
+		AmtMsat:     amountMsat,
+		PaymentHash: paymentHash,
+		DestCustomRecords: map[uint64][]byte{
+			keysendPreimageRecord: preimage,
+		},
+		FeeLimit: &lnrpc.FeeLimit{
+			Limit: &lnrpc.FeeLimit_FixedMsat{
+				FixedMsat: maxFeeMsat,
+			},
+		},
+	})
+}
+
+// PayOffer is not supported. LND can't pay BOLT12 offers
+func (lnd *LND) PayOffer(offer string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error) {
+	return payment, ErrPaymentsNotSupported
+}
+
+// Failed payments are not an error of the request but have the reason in "PaymentError"
+func (lnd *LND) sendPayment(request *lnrpc.SendRequest) (payment Payment, err error) {
+	response, err := lnd.client.SendPaymentSync(lnd.ctx, request)
+
+	if err != nil {
+		return payment, err
+	}
+
+	if response.PaymentError != "" {
+		return payment, &PaymentFailedError{Reason: response.PaymentError}
+	}
+
+	paymentHash := sha256.Sum256(response.PaymentPreimage)
+
+	payment = Payment{
+		RHash:    hex.EncodeToString(paymentHash[:]),
+		Preimage: hex.EncodeToString(response.PaymentPreimage),
+	}
+
+	if response.PaymentRoute != nil {
+		payment.FeeMsat = response.PaymentRoute.TotalFeesMsat
+	}
+
+	return payment, err
+}
@@ -0,0 +1,34 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+func TestLNDToSettledInvoice(t *testing.T) {
+	settled := toSettledInvoice(&lnrpc.Invoice{
+		PaymentRequest: "lnbcrt1lnd",
+		RHash:          []byte{0xaa, 0xbb},
+		AmtPaidMsat:    21000,
+	})
+
+	if settled.Invoice != "lnbcrt1lnd" || settled.RHash != "aabb" || settled.Keysend {
+		t.Errorf("unexpected settled invoice %v", settled)
+	}
+
+	settled = toSettledInvoice(&lnrpc.Invoice{
+		RHash:       []byte{0xcc},
+		AmtPaidMsat: 21500,
+		IsKeysend:   true,
+		Htlcs: []*lnrpc.InvoiceHTLC{
+			{CustomRecords: map[uint64][]byte{}},
+			{CustomRecords: map[uint64][]byte{keysendMessageRecord: []byte("thanks")}},
+		},
+	})
+
+	if !settled.Keysend || settled.RHash != "cc" || settled.AmountMsat != 21500 || settled.Message != "thanks" {
+		t.Errorf("unexpected keysend payment %v", settled)
+	}
+
+}
@@ -0,0 +1,497 @@
+package backends
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// LNDREST contains all values needed to be able to connect to the REST interface of a node
+type LNDREST struct {
+	RESTHost     string `long:"resthost" Description:"Host of the REST interface of LND. HTTPS is used unless the host starts with \"http://\""`
+	CertFile     string `long:"certfile" Description:"TLS certificate for the LND gRPC and REST services. Set to an empty string to trust the certificate authorities of the system"`
+	MacaroonFile string `long:"macaroonfile" Description:"Macaroon file for authentication. Set to an empty string for no macaroon"`
+
+	macaroon string
+	client   *http.Client
+}
+
+// Errors of requests have the field "error" and errors in streams only "message"
+type lndRESTError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (apiError *lndRESTError) getMessage() string {
+	if apiError.Error != "" {
+		return apiError.Error
+	}
+
+	return apiError.Message
+}
+
+type lndRESTAddInvoice struct {
+	Memo            string `json:"memo,omitempty"`
+	DescriptionHash []byte `json:"description_hash,omitempty"`
+	Value           string `json:"value,omitempty"`
+	ValueMsat       string `json:"value_msat,omitempty"`
+	Expiry          string `json:"expiry"`
+	Private         bool   `json:"private,omitempty"`
+	FallbackAddr    string `json:"fallback_addr,omitempty"`
+}
+
+type lndRESTInvoice struct {
+	RHash          string               `json:"r_hash"`
+	PaymentRequest string               `json:"payment_request"`
+	Settled        bool                 `json:"settled"`
+	State          string               `json:"state"`
+	SettleIndex    uint64               `json:"settle_index,string"`
+	AmtPaidMsat    int64                `json:"amt_paid_msat,string"`
+	IsKeysend      bool                 `json:"is_keysend"`
+	IsAMP          bool                 `json:"is_amp"`
+	HTLCs          []lndRESTInvoiceHTLC `json:"htlcs"`
+}
+
+type lndRESTAddHoldInvoice struct {
+	lndRESTAddInvoice
+
+	Hash []byte `json:"hash"`
+}
+
+type lndRESTSettleHoldInvoice struct {
+	Preimage []byte `json:"preimage"`
+}
+
+type lndRESTCancelHoldInvoice struct {
+	PaymentHash []byte `json:"payment_hash"`
+}
+
+type lndRESTFeeLimit struct {
+	FixedMsat string `json:"fixed_msat"`
+}
+
+type lndRESTSendPayment struct {
+	PaymentRequest    string            `json:"payment_request,omitempty"`
+	Dest              []byte            `json:"dest,omitempty"`
+	AmtMsat           string            `json:"amt_msat,omitempty"`
+	PaymentHash       []byte            `json:"payment_hash,omitempty"`
+	DestCustomRecords map[string][]byte `json:"dest_custom_records,omitempty"`
+	FeeLimit          lndRESTFeeLimit   `json:"fee_limit"`
+}
+
+type lndRESTSendResponse struct {
+	PaymentError    string `json:"payment_error"`
+	PaymentPreimage []byte `json:"payment_preimage"`
+	PaymentHash     []byte `json:"payment_hash"`
+
+	PaymentRoute struct {
+		TotalFeesMsat int64 `json:"total_fees_msat,string"`
+	} `json:"payment_route"`
+}
+
+// The state of invoices that were paid but not settled yet
+const lndRESTInvoiceAccepted = "ACCEPTED"
+
+type lndRESTInvoiceHTLC struct {
+	// The values are encoded in base64
+	CustomRecords map[string][]byte `json:"custom_records"`
+}
+
+type lndRESTStreamMessage struct {
+	Result *lndRESTInvoice `json:"result"`
+	Error  *lndRESTError   `json:"error"`
+}
+
+// Connect to a node
+func (lnd *LNDREST) Connect() error {
+	// Proxies in front of LND can have certificates of public certificate authorities
+	var certPool *x509.CertPool
+
+	if lnd.CertFile != "" {
+		cert, err := ioutil.ReadFile(lnd.CertFile)
+
+		if err != nil {
+			log.Error("Failed to read certificate for LND REST")
+
+			return err
+		}
+
+		certPool = x509.NewCertPool()
+
+		if !certPool.AppendCertsFromPEM(cert) {
+			log.Error("Failed to parse certificate for LND REST")
+
+			return errors.New("could not parse certificate")
+		}
+
+	}
+
+	if lnd.MacaroonFile != "" {
+		macaroon, err := ioutil.ReadFile(lnd.MacaroonFile)
+
+		if err != nil {
+			log.Error("Failed to read macaroon file of LND: ", err.Error())
+
+		} else {
+			lnd.macaroon = hex.EncodeToString(macaroon)
+		}
+
+	}
+
+	// Idle connections of a previous call would be kept open otherwise when reconnecting
+	if lnd.client != nil {
+		if transport, ok := lnd.client.Transport.(*http.Transport); ok {
+			transport.CloseIdleConnections()
+		}
+
+	}
+
+	lnd.client = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs: certPool,
+			},
+		},
+	}
+
+	return nil
+}
+
+// GetInvoice gets and invoice from a node
+func (lnd *LNDREST) GetInvoice(options InvoiceOptions) (invoice string, rHash string, err error) {
+	var response lndRESTInvoice
+
+	err = lnd.call(http.MethodPost, "/v1/invoices", newLndRESTAddInvoice(options), &response)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	paymentHash, err := base64.StdEncoding.DecodeString(response.RHash)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return response.PaymentRequest, hex.EncodeToString(paymentHash), err
+}
+
+func newLndRESTAddInvoice(options InvoiceOptions) lndRESTAddInvoice {
+	request := lndRESTAddInvoice{
+		Memo:         options.Description,
+		Expiry:       strconv.FormatInt(options.Expiry, 10),
+		Private:      options.Private,
+		FallbackAddr: options.FallbackAddr,
+	}
+
+	// Byte fields are encoded in base64 which is what the REST interface expects
+	if options.HashDescription {
+		request.Memo = ""
+		request.DescriptionHash = getDescriptionHash(options.Description)
+	}
+
+	// Older versions of LND don't know "value_msat" which is why it is only used when necessary
+	if options.AmountMsat%1000 == 0 {
+		request.Value = strconv.FormatInt(options.AmountMsat/1000, 10)
+
+	} else {
+		request.ValueMsat = strconv.FormatInt(options.AmountMsat, 10)
+	}
+
+	return request
+}
+
+// InvoiceSettled checks if an invoice is settled by looking it up
+func (lnd *LNDREST) InvoiceSettled(rHash string) (settled bool, err error) {
+	var invoice lndRESTInvoice
+
+	err = lnd.call(http.MethodGet, "/v1/invoice/"+rHash, nil, &invoice)
+
+	if err != nil {
+		return false, err
+	}
+
+	return invoice.Settled, err
+}
+
+// SubscribeInvoices subscribe to the invoice events of LND and calls a callback when one is settled
+// Invoices that were settled after the last settle index that got processed are replayed
+func (lnd *LNDREST) SubscribeInvoices(publish PublishInvoiceSettled, rescan RescanPendingInvoices) error {
+	settleIndexKey := "lndrest:" + lnd.RESTHost
+
+	settleIndex := strconv.FormatUint(getSettleIndex(settleIndexKey), 10)
+
+	response, err := lnd.request(http.MethodGet, "/v1/invoices/subscribe?settle_index="+settleIndex, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	// Connected successfully to LND
+	// If there are pending invoices after reconnecting they should get rescanned now
+	rescan()
+
+	decoder := json.NewDecoder(response.Body)
+
+	for {
+		var message lndRESTStreamMessage
+
+		err = decoder.Decode(&message)
+
+		if err == io.EOF {
+			return errors.New("lost connection to LND REST")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if message.Error != nil {
+			return errors.New("error in stream of LND REST: " + message.Error.getMessage())
+		}
+
+		if message.Result != nil && message.Result.Settled {
+			// The settle index is stored after the invoice was processed to make sure it is not lost
+			publish(message.Result.toSettledInvoice())
+
+			setSettleIndex(settleIndexKey, message.Result.SettleIndex)
+		}
+
+	}
+
+}
+
+// AddHoldInvoice creates a hold invoice with the invoices sub-server of LND
+func (lnd *LNDREST) AddHoldInvoice(options InvoiceOptions, paymentHash []byte) (invoice string, err error) {
+	var response lndRESTInvoice
+
+	err = lnd.call(http.MethodPost, "/v2/invoices/hodl", lndRESTAddHoldInvoice{
+		lndRESTAddInvoice: newLndRESTAddInvoice(options),
+		Hash:              paymentHash,
+	}, &response)
+
+	if err != nil {
+		return "", err
+	}
+
+	return response.PaymentRequest, err
+}
+
+// HoldInvoiceAccepted checks whether a hold invoice was paid by looking it up
+func (lnd *LNDREST) HoldInvoiceAccepted(rHash string) (accepted bool, err error) {
+	var invoice lndRESTInvoice
+
+	err = lnd.call(http.MethodGet, "/v1/invoice/"+rHash, nil, &invoice)
+
+	if err != nil {
+		return false, err
+	}
+
+	return invoice.State == lndRESTInvoiceAccepted, err
+}
+
+// SettleHoldInvoice settles a hold invoice that was accepted
+func (lnd *LNDREST) SettleHoldInvoice(preimage []byte) error {
+	var response json.RawMessage
+
+	return lnd.call(http.MethodPost, "/v2/invoices/settle", lndRESTSettleHoldInvoice{
+		Preimage: preimage,
+	}, &response)
+}
+
+// CancelHoldInvoice cancels a hold invoice and refunds the payer if it was accepted already
+func (lnd *LNDREST) CancelHoldInvoice(rHash string) error {
+	paymentHash, err := hex.DecodeString(rHash)
+
+	if err != nil {
+		return err
+	}
+
+	var response json.RawMessage
+
+	return lnd.call(http.MethodPost, "/v2/invoices/cancel", lndRESTCancelHoldInvoice{
+		PaymentHash: paymentHash,
+	}, &response)
+}
+
+// PayInvoice pays an invoice. The macaroon needs the permission to send payments
+func (lnd *LNDREST) PayInvoice(invoice string, maxFeeMsat int64) (payment Payment, err error) {
+	return lnd.sendPayment(lndRESTSendPayment{
+		PaymentRequest: invoice,
+		FeeLimit: lndRESTFeeLimit{
+			FixedMsat: strconv.FormatInt(maxFeeMsat, 10),
+		},
+	})
+}
+
+// SendKeysend sends a spontaneous payment with a random preimage
+func (lnd *LNDREST) SendKeysend(pubkey string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error) {
+	dest, err := hex.DecodeString(pubkey)
+
+	if err != nil {
+		return payment, err
+	}
+
+	preimage, paymentHash, err := newPreimage()
+
+	if err != nil {
+		return payment, err
+	}
+
+	return lnd.sendPayment(lndRESTSendPayment{
+		Dest:        dest,
+		AmtMsat:     strconv.FormatInt(amountMsat, 10),
+		PaymentHash: paymentHash,
+		DestCustomRecords: map[string][]byte{
+			strconv.FormatUint(keysendPreimageRecord, 10): preimage,
+		},
+		FeeLimit: lndRESTFeeLimit{
+			FixedMsat: strconv.FormatInt(maxFeeMsat, 10),
+		},
+	})
+}
+
+// PayOffer is not supported. LND can't pay BOLT12 offers
+func (lnd *LNDREST) PayOffer(offer string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error) {
+	return payment, ErrPaymentsNotSupported
+}
+
+// Failed payments are not an error of the request but have the reason in "payment_error"
+func (lnd *LNDREST) sendPayment(request lndRESTSendPayment) (payment Payment, err error) {
+	var response lndRESTSendResponse
+
+	err = lnd.call(http.MethodPost, "/v1/channels/transactions", request, &response)
+
+	if err != nil {
+		return payment, err
+	}
+
+	if response.PaymentError != "" {
+		return payment, &PaymentFailedError{Reason: response.PaymentError}
+	}
+
+	return Payment{
+		RHash:    hex.EncodeToString(response.PaymentHash),
+		Preimage: hex.EncodeToString(response.PaymentPreimage),
+		FeeMsat:  response.PaymentRoute.TotalFeesMsat,
+	}, err
+}
+
+// AMP invoices can be created with a payment request too. Only the ones without one were paid spontaneously
+func (invoice *lndRESTInvoice) toSettledInvoice() SettledInvoice {
+	settled := SettledInvoice{
+		Invoice: invoice.PaymentRequest,
+	}
+
+	if paymentHash, err := base64.StdEncoding.DecodeString(invoice.RHash); err == nil {
+		settled.RHash = hex.EncodeToString(paymentHash)
+	}
+
+	if invoice.PaymentRequest == "" && (invoice.IsKeysend || invoice.IsAMP) {
+		settled.Keysend = true
+		settled.AmountMsat = invoice.AmtPaidMsat
+
+		key := strconv.FormatUint(keysendMessageRecord, 10)
+
+		for _, htlc := range invoice.HTLCs {
+			if message, ok := htlc.CustomRecords[key]; ok {
+				settled.Message = string(message)
+
+				break
+			}
+		}
+
+	}
+
+	return settled
+}
+
+// KeepAliveRequest is a dummy request to make sure the connection to LND doesn't time out if
+// LND and LightningTip are separated with a firewall
+func (lnd *LNDREST) KeepAliveRequest() error {
+	var response json.RawMessage
+
+	return lnd.call(http.MethodGet, "/v1/getinfo", nil, &response)
+}
+
+func (lnd *LNDREST) call(method string, path string, body interface{}, result interface{}) error {
+	response, err := lnd.request(method, path, body)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, result)
+}
+
+// The caller has to close the body of the response if no error is returned
+func (lnd *LNDREST) request(method string, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	host := lnd.RESTHost
+
+	if !strings.HasPrefix(host, "https://") && !strings.HasPrefix(host, "http://") {
+		host = "https://" + host
+	}
+
+	request, err := http.NewRequest(method, strings.TrimSuffix(host, "/")+path, reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if lnd.macaroon != "" {
+		request.Header.Set("Grpc-Metadata-macaroon", lnd.macaroon)
+	}
+
+	response, err := lnd.client.Do(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+
+		var apiError lndRESTError
+
+		data, _ := ioutil.ReadAll(response.Body)
+
+		if json.Unmarshal(data, &apiError) == nil && apiError.getMessage() != "" {
+			return nil, errors.New(apiError.getMessage())
+		}
+
+		return nil, errors.New("unexpected response status of LND REST: " + response.Status)
+	}
+
+	return response, err
+}
@@ -0,0 +1,228 @@
+package backends
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// Starts a stand-in of the REST interface of LND and connects to it with its certificate
+func startLNDRESTStub(t *testing.T, handler http.Handler) (server *httptest.Server, lnd *LNDREST) {
+	server = httptest.NewTLSServer(handler)
+
+	certFile, err := ioutil.TempFile("", "lightningtip-lndrest")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(certFile.Name())
+
+	pem.Encode(certFile, &pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	})
+
+	certFile.Close()
+
+	lnd = &LNDREST{
+		RESTHost: server.URL,
+		CertFile: certFile.Name(),
+	}
+
+	if err = lnd.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	return server, lnd
+}
+
+func TestLNDRESTGetInvoice(t *testing.T) {
+	paymentHash := []byte{0xaa, 0xbb, 0xcc}
+
+	var request map[string]interface{}
+
+	server, lnd := startLNDRESTStub(t, http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/invoices" {
+			writer.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		request = nil
+		json.NewDecoder(r.Body).Decode(&request)
+
+		json.NewEncoder(writer).Encode(map[string]interface{}{
+			"r_hash":          base64.StdEncoding.EncodeToString(paymentHash),
+			"payment_request": "lnbcrt1lnd",
+		})
+	}))
+	defer server.Close()
+
+	invoice, rHash, err := lnd.GetInvoice(InvoiceOptions{AmountMsat: 21000, Expiry: 3600})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if invoice != "lnbcrt1lnd" || rHash != hex.EncodeToString(paymentHash) {
+		t.Errorf("unexpected invoice %s with hash %s", invoice, rHash)
+	}
+
+	// Whole satoshis are sent as "value" for older versions of LND
+	if request["value"] != "21" || request["value_msat"] != nil || request["expiry"] != "3600" {
+		t.Errorf("unexpected request for whole satoshis %v", request)
+	}
+
+	if _, _, err = lnd.GetInvoice(InvoiceOptions{AmountMsat: 1500}); err != nil {
+		t.Fatal(err)
+	}
+
+	if request["value_msat"] != "1500" || request["value"] != nil {
+		t.Errorf("unexpected request for fractional satoshis %v", request)
+	}
+
+}
+
+func TestLNDRESTSubscribeInvoices(t *testing.T) {
+	store, reset := useMemorySettleIndexStore()
+	defer reset()
+
+	messageRecord := base64.StdEncoding.EncodeToString([]byte("thanks"))
+
+	// The first stream ends with an error message and the second one without any
+	streams := []string{
+		`{"result": {"r_hash": "` + base64.StdEncoding.EncodeToString([]byte{1}) + `", "payment_request": "lnbcrt1open", "settled": false}}
+		{"result": {"r_hash": "` + base64.StdEncoding.EncodeToString([]byte{2}) + `", "payment_request": "lnbcrt1paid", "settled": true, "settle_index": "5"}}
+		{"result": {"r_hash": "` + base64.StdEncoding.EncodeToString([]byte{3}) + `", "settled": true, "settle_index": "6",
+			"amt_paid_msat": "21000", "is_keysend": true, "htlcs": [{"custom_records": {"34349334": "` + messageRecord + `"}}]}}
+		{"error": {"grpc_code": 1, "http_code": 408, "message": "context canceled", "http_status": "Request Timeout"}}`,
+		``,
+	}
+
+	var settleIndexes []string
+
+	server, lnd := startLNDRESTStub(t, http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/invoices/subscribe" || len(streams) == 0 {
+			writer.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		settleIndexes = append(settleIndexes, r.URL.Query().Get("settle_index"))
+
+		writer.Write([]byte(streams[0]))
+
+		streams = streams[1:]
+	}))
+	defer server.Close()
+
+	store.SetSettleIndex("lndrest:"+lnd.RESTHost, 4)
+
+	var published []SettledInvoice
+	rescanned := false
+
+	err := lnd.SubscribeInvoices(func(settled SettledInvoice) {
+		published = append(published, settled)
+	}, func() {
+		rescanned = true
+	})
+
+	if err == nil || err.Error() != "error in stream of LND REST: context canceled" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if !rescanned {
+		t.Error("pending invoices were not rescanned")
+	}
+
+	if len(published) != 2 {
+		t.Fatalf("unexpected settled invoices %v", published)
+	}
+
+	if published[0].Invoice != "lnbcrt1paid" || published[0].RHash != "02" || published[0].Keysend {
+		t.Errorf("unexpected settled invoice %v", published[0])
+	}
+
+	if !published[1].Keysend || published[1].RHash != "03" || published[1].AmountMsat != 21000 || published[1].Message != "thanks" {
+		t.Errorf("unexpected keysend payment %v", published[1])
+	}
+
+	err = lnd.SubscribeInvoices(func(settled SettledInvoice) {
+		t.Errorf("unexpected settled invoice %v", settled)
+	}, func() {})
+
+	if err == nil || err.Error() != "lost connection to LND REST" {
+		t.Errorf("unexpected error at the end of the stream %v", err)
+	}
+
+	// The second subscription has to resume after the last settled invoice of the first one
+	if len(settleIndexes) != 2 || settleIndexes[0] != "4" || settleIndexes[1] != "6" {
+		t.Errorf("unexpected settle indexes %v", settleIndexes)
+	}
+
+}
+
+func TestLNDRESTErrors(t *testing.T) {
+	server, lnd := startLNDRESTStub(t, http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/invoices" {
+			writer.WriteHeader(http.StatusInternalServerError)
+			writer.Write([]byte(`{"error": "invoice expiry too soon", "message": "invoice expiry too soon", "code": 2}`))
+
+			return
+		}
+
+		writer.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	if _, _, err := lnd.GetInvoice(InvoiceOptions{AmountMsat: 1000}); err == nil || err.Error() != "invoice expiry too soon" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if err := lnd.KeepAliveRequest(); err == nil || err.Error() != "unexpected response status of LND REST: 404 Not Found" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+}
+
+func TestLNDRESTScheme(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		writer.Write([]byte(`{}`))
+	})
+
+	// Reverse proxies on the same machine can be reached without TLS
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	lnd := &LNDREST{RESTHost: server.URL}
+
+	if err := lnd.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lnd.KeepAliveRequest(); err != nil {
+		t.Errorf("could not reach LND REST over HTTP: %v", err)
+	}
+
+	// Without a certificate file only the certificate authorities of the system are trusted
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+
+	lnd = &LNDREST{RESTHost: tlsServer.URL}
+
+	if err := lnd.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lnd.KeepAliveRequest(); err == nil {
+		t.Error("self signed certificate was trusted without certificate file")
+	}
+
+}
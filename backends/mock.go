@@ -0,0 +1,466 @@
+package backends
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/zpay32"
+)
+
+// Mock is a backend that runs in process and does not need a Lightning node
+// It is meant for development and demos and must never be used to accept real tips
+type Mock struct {
+	SettleDelay int64  `long:"settledelay" Description:"Seconds after which invoices get settled automatically. Set to 0 to settle them only via the debug endpoint"`
+	DebugHost   string `long:"debughost" Description:"Host for the debug HTTP endpoint to settle invoices on demand. Set to an empty string to disable it"`
+
+	FailPayments bool `long:"failpayments" Description:"Whether all payments should fail"`
+
+	lock     sync.Mutex
+	invoices map[string]*mockInvoice
+	payments []mockPayment
+
+	// Invoices are signed with a key that is created when connecting
+	key *btcec.PrivateKey
+
+	settled chan SettledInvoice
+
+	startDebugServer sync.Once
+}
+
+type mockInvoice struct {
+	Invoice    string
+	RHash      string
+	AmountMsat int64
+	Message    string
+	Settled    bool
+
+	// Paying a hold invoice only accepts it. It has to be settled or canceled afterwards
+	Hold     bool
+	Accepted bool
+	Canceled bool
+}
+
+// mockPayment is a payment the mock backend pretended to send
+type mockPayment struct {
+	Type        string
+	Destination string
+	AmountMsat  int64
+	RHash       string
+}
+
+// Connect to the mock backend which just initializes it
+func (mock *Mock) Connect() error {
+	mock.lock.Lock()
+
+	if mock.invoices == nil {
+		key, err := btcec.NewPrivateKey(btcec.S256())
+
+		if err != nil {
+			mock.lock.Unlock()
+
+			return err
+		}
+
+		mock.key = key
+		mock.invoices = make(map[string]*mockInvoice)
+		mock.settled = make(chan SettledInvoice, 128)
+	}
+
+	mock.lock.Unlock()
+
+	if mock.DebugHost != "" {
+		mock.startDebugServer.Do(func() {
+			log.Warning("Using mock backend. Invoices can be settled at: http://" + mock.DebugHost + "/settle?rhash=")
+			log.Warning("Keysend payments can be simulated at: http://" + mock.DebugHost + "/keysend?amount=&message=")
+
+			mux := http.NewServeMux()
+
+			mux.HandleFunc("/invoices", mock.invoicesHandler)
+			mux.HandleFunc("/settle", mock.settleHandler)
+			mux.HandleFunc("/keysend", mock.keysendHandler)
+			mux.HandleFunc("/payments", mock.paymentsHandler)
+
+			go func() {
+				err := http.ListenAndServe(mock.DebugHost, mux)
+
+				if err != nil {
+					log.Error("Failed to start debug HTTP server of mock backend: " + err.Error())
+				}
+			}()
+		})
+	}
+
+	return nil
+}
+
+// GetInvoice creates an invoice that looks like a real one but can't be paid
+func (mock *Mock) GetInvoice(options InvoiceOptions) (invoice string, rHash string, err error) {
+	preimage := make([]byte, 32)
+
+	_, err = rand.Read(preimage)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	paymentHash := sha256.Sum256(preimage)
+
+	invoice, err = mock.addInvoice(options, paymentHash[:], false)
+
+	return invoice, hex.EncodeToString(paymentHash[:]), err
+}
+
+// AddHoldInvoice creates a hold invoice that gets accepted like other invoices get settled
+func (mock *Mock) AddHoldInvoice(options InvoiceOptions, paymentHash []byte) (invoice string, err error) {
+	return mock.addInvoice(options, paymentHash, true)
+}
+
+// HoldInvoiceAccepted checks if a hold invoice was accepted and is neither settled nor canceled
+func (mock *Mock) HoldInvoiceAccepted(rHash string) (accepted bool, err error) {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+
+	invoice, ok := mock.invoices[rHash]
+
+	if !ok {
+		return false, errors.New("could not find invoice")
+	}
+
+	return invoice.Accepted && !invoice.Settled && !invoice.Canceled, err
+}
+
+// SettleHoldInvoice settles an accepted hold invoice
+func (mock *Mock) SettleHoldInvoice(preimage []byte) error {
+	paymentHash := sha256.Sum256(preimage)
+	rHash := hex.EncodeToString(paymentHash[:])
+
+	mock.lock.Lock()
+
+	invoice, ok := mock.invoices[rHash]
+
+	if !ok || !invoice.Hold || !invoice.Accepted || invoice.Settled || invoice.Canceled {
+		mock.lock.Unlock()
+
+		return errors.New("invoice is not an accepted hold invoice")
+	}
+
+	invoice.Settled = true
+
+	mock.lock.Unlock()
+
+	log.Debug("Mock backend settled hold invoice: " + invoice.Invoice)
+
+	mock.settled <- SettledInvoice{
+		Invoice: invoice.Invoice,
+		RHash:   invoice.RHash,
+	}
+
+	return nil
+}
+
+// CancelHoldInvoice cancels a hold invoice that is not settled yet
+func (mock *Mock) CancelHoldInvoice(rHash string) error {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+
+	invoice, ok := mock.invoices[rHash]
+
+	if !ok || !invoice.Hold || invoice.Settled {
+		return errors.New("invoice is not an unsettled hold invoice")
+	}
+
+	invoice.Canceled = true
+
+	log.Debug("Mock backend canceled hold invoice: " + invoice.Invoice)
+
+	return nil
+}
+
+func (mock *Mock) addInvoice(options InvoiceOptions, paymentHash []byte, hold bool) (invoice string, err error) {
+	invoice, err = mock.encodeInvoice(paymentHash, options)
+
+	if err != nil {
+		return "", err
+	}
+
+	rHash := hex.EncodeToString(paymentHash)
+
+	mock.lock.Lock()
+
+	mock.invoices[rHash] = &mockInvoice{
+		Invoice:    invoice,
+		RHash:      rHash,
+		AmountMsat: options.AmountMsat,
+		Message:    options.Description,
+		Hold:       hold,
+	}
+
+	mock.lock.Unlock()
+
+	if mock.SettleDelay > 0 {
+		time.AfterFunc(time.Duration(mock.SettleDelay)*time.Second, func() {
+			mock.settle(rHash)
+		})
+	}
+
+	return invoice, err
+}
+
+// InvoiceSettled checks if an invoice was settled
+func (mock *Mock) InvoiceSettled(rHash string) (settled bool, err error) {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+
+	invoice, ok := mock.invoices[rHash]
+
+	if !ok {
+		return false, errors.New("could not find invoice")
+	}
+
+	return invoice.Settled, err
+}
+
+// SubscribeInvoices calls a callback for every invoice that gets settled
+func (mock *Mock) SubscribeInvoices(publish PublishInvoiceSettled, rescan RescanPendingInvoices) error {
+	rescan()
+
+	for invoice := range mock.settled {
+		go publish(invoice)
+	}
+
+	return errors.New("mock backend stopped")
+}
+
+// KeepAliveRequest does nothing because there is no connection that could time out
+func (mock *Mock) KeepAliveRequest() error {
+	return nil
+}
+
+// Pay simulates a payment of an invoice like the debug endpoint does. Hold invoices are only accepted
+func (mock *Mock) Pay(rHash string) error {
+	return mock.settle(rHash)
+}
+
+func (mock *Mock) settle(rHash string) error {
+	mock.lock.Lock()
+
+	invoice, ok := mock.invoices[rHash]
+
+	if !ok {
+		mock.lock.Unlock()
+
+		return errors.New("could not find invoice")
+	}
+
+	if invoice.Settled || invoice.Accepted || invoice.Canceled {
+		mock.lock.Unlock()
+
+		return errors.New("invoice was paid already or canceled")
+	}
+
+	if invoice.Hold {
+		invoice.Accepted = true
+
+		mock.lock.Unlock()
+
+		log.Debug("Mock backend accepted hold invoice: " + invoice.Invoice)
+
+		return nil
+	}
+
+	invoice.Settled = true
+
+	mock.lock.Unlock()
+
+	log.Debug("Mock backend settled invoice: " + invoice.Invoice)
+
+	mock.settled <- SettledInvoice{
+		Invoice: invoice.Invoice,
+		RHash:   invoice.RHash,
+	}
+
+	return nil
+}
+
+func (mock *Mock) invoicesHandler(writer http.ResponseWriter, request *http.Request) {
+	mock.lock.Lock()
+
+	invoices := make([]mockInvoice, 0, len(mock.invoices))
+
+	for _, invoice := range mock.invoices {
+		invoices = append(invoices, *invoice)
+	}
+
+	mock.lock.Unlock()
+
+	writeMockResponse(writer, http.StatusOK, invoices)
+}
+
+func (mock *Mock) settleHandler(writer http.ResponseWriter, request *http.Request) {
+	err := mock.settle(request.FormValue("rhash"))
+
+	if err != nil {
+		writeMockResponse(writer, http.StatusBadRequest, map[string]string{
+			"Error": err.Error(),
+		})
+
+		return
+	}
+
+	writeMockResponse(writer, http.StatusOK, map[string]bool{
+		"Settled": true,
+	})
+}
+
+// Simulates a keysend payment. The amount is denominated in millisatoshis
+func (mock *Mock) keysendHandler(writer http.ResponseWriter, request *http.Request) {
+	amountMsat, err := strconv.ParseInt(request.FormValue("amount"), 10, 64)
+
+	if err != nil || amountMsat <= 0 {
+		writeMockResponse(writer, http.StatusBadRequest, map[string]string{
+			"Error": "invalid amount",
+		})
+
+		return
+	}
+
+	paymentHash := make([]byte, 32)
+
+	_, err = rand.Read(paymentHash)
+
+	if err != nil {
+		writeMockResponse(writer, http.StatusInternalServerError, map[string]string{
+			"Error": err.Error(),
+		})
+
+		return
+	}
+
+	rHash := hex.EncodeToString(paymentHash)
+
+	log.Debug("Mock backend received keysend payment: " + rHash)
+
+	mock.settled <- SettledInvoice{
+		RHash:      rHash,
+		Keysend:    true,
+		AmountMsat: amountMsat,
+		Message:    request.FormValue("message"),
+	}
+
+	writeMockResponse(writer, http.StatusOK, map[string]string{
+		"RHash": rHash,
+	})
+}
+
+func (mock *Mock) paymentsHandler(writer http.ResponseWriter, request *http.Request) {
+	mock.lock.Lock()
+
+	payments := append([]mockPayment{}, mock.payments...)
+
+	mock.lock.Unlock()
+
+	writeMockResponse(writer, http.StatusOK, payments)
+}
+
+// PayInvoice pretends to pay an invoice. The amount of the invoice is not decoded
+func (mock *Mock) PayInvoice(invoice string, maxFeeMsat int64) (payment Payment, err error) {
+	return mock.pay("invoice", invoice, 0)
+}
+
+// SendKeysend pretends to send a keysend payment
+func (mock *Mock) SendKeysend(pubkey string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error) {
+	return mock.pay("keysend", pubkey, amountMsat)
+}
+
+// PayOffer pretends to pay an offer
+func (mock *Mock) PayOffer(offer string, amountMsat int64, maxFeeMsat int64) (payment Payment, err error) {
+	return mock.pay("offer", offer, amountMsat)
+}
+
+// Payments of the mock backend have no fees
+func (mock *Mock) pay(paymentType string, destination string, amountMsat int64) (payment Payment, err error) {
+	if mock.FailPayments {
+		return payment, &PaymentFailedError{Reason: "mock backend is configured to fail payments"}
+	}
+
+	preimage, paymentHash, err := newPreimage()
+
+	if err != nil {
+		return payment, err
+	}
+
+	payment = Payment{
+		RHash:    hex.EncodeToString(paymentHash),
+		Preimage: hex.EncodeToString(preimage),
+	}
+
+	log.Debug("Mock backend sent " + paymentType + " payment to " + destination)
+
+	mock.lock.Lock()
+
+	mock.payments = append(mock.payments, mockPayment{
+		Type:        paymentType,
+		Destination: destination,
+		AmountMsat:  amountMsat,
+		RHash:       payment.RHash,
+	})
+
+	mock.lock.Unlock()
+
+	return payment, err
+}
+
+func writeMockResponse(writer http.ResponseWriter, status int, data interface{}) {
+	response, _ := json.MarshalIndent(data, "", "    ")
+
+	writer.WriteHeader(status)
+	writer.Write(response)
+}
+
+// Encodes an invoice for regtest that is signed with the key of the mock backend
+// Private route hints and fallback addresses are not encoded
+func (mock *Mock) encodeInvoice(paymentHash []byte, options InvoiceOptions) (string, error) {
+	var hash [32]byte
+	copy(hash[:], paymentHash)
+
+	invoiceOptions := []func(*zpay32.Invoice){
+		zpay32.Expiry(time.Duration(options.Expiry) * time.Second),
+	}
+
+	if options.AmountMsat > 0 {
+		invoiceOptions = append(invoiceOptions, zpay32.Amount(lnwire.MilliSatoshi(options.AmountMsat)))
+	}
+
+	if options.HashDescription {
+		var descriptionHash [32]byte
+		copy(descriptionHash[:], getDescriptionHash(options.Description))
+
+		invoiceOptions = append(invoiceOptions, zpay32.DescriptionHash(descriptionHash))
+
+	} else {
+		invoiceOptions = append(invoiceOptions, zpay32.Description(options.Description))
+	}
+
+	invoice, err := zpay32.NewInvoice(&chaincfg.RegressionNetParams, hash, time.Now(), invoiceOptions...)
+
+	if err != nil {
+		return "", err
+	}
+
+	return invoice.Encode(zpay32.MessageSigner{
+		SignCompact: func(message []byte) ([]byte, error) {
+			return btcec.SignCompact(btcec.S256(), mock.key, chainhash.HashB(message), true)
+		},
+	})
+}
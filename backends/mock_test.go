@@ -0,0 +1,80 @@
+package backends
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/lightningnetwork/lnd/zpay32"
+)
+
+func TestMockInvoiceEncoding(t *testing.T) {
+	mock := &Mock{}
+
+	if err := mock.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The longest description that fits into an invoice and one that only fits as hash
+	longest := strings.Repeat("a", 639)
+
+	tests := []InvoiceOptions{
+		{Description: "thanks", AmountMsat: 21000, Expiry: 3600},
+		{Description: "fractional", AmountMsat: 1500, Expiry: 60},
+		{Description: longest, AmountMsat: 2500000000, Expiry: 86400},
+		{Description: longest + "a", HashDescription: true, AmountMsat: 1000, Expiry: 3600},
+		{Description: "no amount", Expiry: 3600},
+	}
+
+	for _, options := range tests {
+		invoice, rHash, err := mock.GetInvoice(options)
+
+		if err != nil {
+			t.Fatalf("could not create invoice for %s: %v", options.Description, err)
+		}
+
+		decoded, err := zpay32.Decode(invoice, &chaincfg.RegressionNetParams)
+
+		if err != nil {
+			t.Fatalf("could not decode invoice for %s: %v", options.Description, err)
+		}
+
+		if options.AmountMsat == 0 {
+			if decoded.MilliSat != nil {
+				t.Errorf("invoice without amount has amount %d", *decoded.MilliSat)
+			}
+
+		} else if decoded.MilliSat == nil || int64(*decoded.MilliSat) != options.AmountMsat {
+			t.Errorf("unexpected amount of invoice %v instead of %d", decoded.MilliSat, options.AmountMsat)
+		}
+
+		if hex.EncodeToString(decoded.PaymentHash[:]) != rHash {
+			t.Errorf("unexpected payment hash %x instead of %s", decoded.PaymentHash[:], rHash)
+		}
+
+		if decoded.Expiry() != time.Duration(options.Expiry)*time.Second {
+			t.Errorf("unexpected expiry %v", decoded.Expiry())
+		}
+
+		if options.HashDescription {
+			if decoded.Description != nil || decoded.DescriptionHash == nil ||
+				*decoded.DescriptionHash != sha256.Sum256([]byte(options.Description)) {
+
+				t.Errorf("unexpected description hash of invoice for %s", options.Description)
+			}
+
+		} else if decoded.Description == nil || *decoded.Description != options.Description {
+			t.Errorf("unexpected description of invoice %v", decoded.Description)
+		}
+
+	}
+
+	// Descriptions that don't fit into an invoice have to be hashed
+	if _, _, err := mock.GetInvoice(InvoiceOptions{Description: longest + "a", AmountMsat: 1000}); err == nil {
+		t.Error("invoice with too long description was created")
+	}
+
+}
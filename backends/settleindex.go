@@ -0,0 +1,42 @@
+package backends
+
+// SettleIndexStore persists the index of the last settled invoice a subscription has processed
+// so that the subscription can be resumed from there after reconnecting or restarting
+type SettleIndexStore interface {
+	GetSettleIndex(key string) (uint64, error)
+	SetSettleIndex(key string, index uint64) error
+}
+
+var settleIndexStore SettleIndexStore
+
+// UseSettleIndexStore tells the backends package where to persist settle indexes
+func UseSettleIndexStore(store SettleIndexStore) {
+	settleIndexStore = store
+}
+
+// Returns 0 if there is no index stored for the key
+func getSettleIndex(key string) uint64 {
+	if settleIndexStore == nil {
+		return 0
+	}
+
+	index, err := settleIndexStore.GetSettleIndex(key)
+
+	if err != nil {
+		log.Warning("Failed to get settle index of " + key + ": " + err.Error())
+	}
+
+	return index
+}
+
+func setSettleIndex(key string, index uint64) {
+	if settleIndexStore == nil || index == 0 {
+		return
+	}
+
+	err := settleIndexStore.SetSettleIndex(key, index)
+
+	if err != nil {
+		log.Warning("Failed to store settle index of " + key + ": " + err.Error())
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"github.com/michael1011/lightningtip/rates"
 	"github.com/urfave/cli"
 	"strconv"
 	"time"
@@ -25,21 +26,22 @@ func summary(ctx *cli.Context) error {
 	db, err := openDatabase(ctx)
 
 	if err == nil {
-		rows, err := getTips(db)
+		rows, err := getTips(db, ctx.GlobalString("jar"))
 
 		if err == nil {
 			var tips int64
 			var sum int64
 
 			var unixDate int64
-			var amount int64
+			var amountMsat int64
 			var message string
+			var keysend bool
 
 			for rows.Next() {
-				err = rows.Scan(&unixDate, &amount, &message)
+				err = rows.Scan(&unixDate, &amountMsat, &message, &keysend)
 
 				tips++
-				sum += amount
+				sum += amountMsat
 			}
 
 			if err == nil {
@@ -49,7 +51,7 @@ func summary(ctx *cli.Context) error {
 				date = date[:len(date)-6]
 
 				fmt.Println("Received " + formatInt(tips) + " tips since " + date +
-					" totalling " + formatInt(sum) + " satoshis")
+					" totalling " + rates.FormatMsat(sum) + " satoshis")
 			}
 
 		}
@@ -70,7 +72,7 @@ func list(ctx *cli.Context) error {
 	db, err := openDatabase(ctx)
 
 	if err == nil {
-		rows, err := getTips(db)
+		rows, err := getTips(db, ctx.GlobalString("jar"))
 
 		if err == nil {
 			var tips []tip
@@ -79,13 +81,19 @@ func list(ctx *cli.Context) error {
 			maxAmountSize := 6
 
 			var unixDate int64
-			var amount int64
+			var amountMsat int64
 			var message string
+			var keysend bool
 
 			for rows.Next() {
-				err = rows.Scan(&unixDate, &amount, &message)
+				err = rows.Scan(&unixDate, &amountMsat, &message, &keysend)
 
-				amountString := formatInt(amount)
+				amountString := rates.FormatMsat(amountMsat)
+
+				// Tips received with keysend were not requested via LightningTip
+				if keysend {
+					message = "[keysend] " + message
+				}
 
 				tips = append(tips, tip{
 					Date:    formatUnixDate(unixDate),
@@ -114,6 +122,255 @@ func list(ctx *cli.Context) error {
 	return err
 }
 
+var goalsCommand = cli.Command{
+	Name:   "goals",
+	Usage:  "Shows how much was raised for each fundraising goal",
+	Action: goals,
+}
+
+func goals(ctx *cli.Context) error {
+	db, err := openDatabase(ctx)
+
+	if err == nil {
+		rows, err := getGoals(db)
+
+		if err == nil {
+			var id string
+			var label string
+			var targetMsat int64
+			var start int64
+			var end int64
+			var raisedMsat int64
+			var tips int64
+
+			for rows.Next() {
+				err = rows.Scan(&id, &label, &targetMsat, &start, &end, &raisedMsat, &tips)
+
+				if err != nil {
+					break
+				}
+
+				progress := strconv.FormatFloat(float64(raisedMsat)/float64(targetMsat)*100, 'f', 2, 64)
+
+				fmt.Println(label + " (" + id + "): " + rates.FormatMsat(raisedMsat) + " of " + rates.FormatMsat(targetMsat) +
+					" satoshis (" + progress + "%) from " + formatInt(tips) + " tips" + formatGoalDates(start, end))
+			}
+
+		}
+
+		return err
+	}
+
+	return err
+}
+
+// The end of a goal is stored as the start of the day after its end date
+func formatGoalDates(start int64, end int64) (dates string) {
+	if start != 0 {
+		dates += " from " + time.Unix(start, 0).Format("02-01-2006")
+	}
+
+	if end != 0 {
+		dates += " until " + time.Unix(end, 0).AddDate(0, 0, -1).Format("02-01-2006")
+	}
+
+	return dates
+}
+
+var payoutsCommand = cli.Command{
+	Name:   "payouts",
+	Usage:  "Shows the payouts of the shares of tips to collaborators",
+	Action: payouts,
+}
+
+func payouts(ctx *cli.Context) error {
+	db, err := openDatabase(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := getPayouts(db)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	var paid int64
+	var fees int64
+	var pending int64
+
+	fmt.Println("Date              State    Attempts  Amount  Fee  Destination")
+
+	for rows.Next() {
+		var id int64
+		var created int64
+		var destination string
+		var amountMsat int64
+		var state string
+		var attempts int64
+		var feeMsat int64
+		var lastError string
+
+		err = rows.Scan(&id, &created, &destination, &amountMsat, &state, &attempts, &feeMsat, &lastError)
+
+		if err != nil {
+			return err
+		}
+
+		switch state {
+		case "paid":
+			paid += amountMsat
+			fees += feeMsat
+
+		case "pending", "sending":
+			pending += amountMsat
+		}
+
+		fmt.Println(formatUnixDate(created) + "  " + state + getSpacing(len(state), 7) + formatInt(attempts) +
+			getSpacing(len(formatInt(attempts)), 8) + rates.FormatMsat(amountMsat) + "  " + rates.FormatMsat(feeMsat) + "  " + destination)
+
+		// The error of the last attempt is interesting only if the payout was not sent successfully
+		if state != "paid" && lastError != "" {
+			fmt.Println("                  Last error: " + lastError)
+		}
+
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	var collecting int64
+
+	err = db.QueryRow("SELECT IFNULL(SUM(amount_msat), 0) FROM payout_shares WHERE payout IS NULL").Scan(&collecting)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println("Paid out " + rates.FormatMsat(paid) + " satoshis with fees of " + rates.FormatMsat(fees) + " satoshis")
+	fmt.Println(rates.FormatMsat(pending) + " satoshis are waiting to be paid out and " + rates.FormatMsat(collecting) +
+		" satoshis are collected until there is enough for a payout")
+
+	return err
+}
+
+var webhooksCommand = cli.Command{
+	Name:   "webhooks",
+	Usage:  "Shows the deliveries of events to the webhooks",
+	Action: webhooks,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "attempts",
+			Usage: "show every attempt to deliver an event",
+		},
+	},
+}
+
+func webhooks(ctx *cli.Context) error {
+	db, err := openDatabase(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := getWebhookDeliveries(db)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	states := make(map[string]int64)
+
+	fmt.Println("Date              Event             State      Attempts  Status  URL")
+
+	for rows.Next() {
+		var id int64
+		var created int64
+		var url string
+		var event string
+		var state string
+		var attempts int64
+		var lastStatus int64
+		var lastError string
+
+		err = rows.Scan(&id, &created, &url, &event, &state, &attempts, &lastStatus, &lastError)
+
+		if err != nil {
+			return err
+		}
+
+		states[state]++
+
+		status := "-"
+
+		if lastStatus != 0 {
+			status = formatInt(lastStatus)
+		}
+
+		fmt.Println(formatUnixDate(created) + "  " + event + getSpacing(len(event), 16) + state + getSpacing(len(state), 9) +
+			formatInt(attempts) + getSpacing(len(formatInt(attempts)), 8) + status + getSpacing(len(status), 6) + url)
+
+		if ctx.Bool("attempts") {
+			err = printWebhookAttempts(db, id)
+
+			if err != nil {
+				return err
+			}
+
+		} else if state != "delivered" && lastError != "" {
+			fmt.Println("                  Last error: " + lastError)
+		}
+
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(formatInt(states["delivered"]) + " deliveries succeeded, " + formatInt(states["pending"]) +
+		" are waiting to be retried and " + formatInt(states["failed"]) + " failed")
+
+	return err
+}
+
+func printWebhookAttempts(db *sql.DB, delivery int64) error {
+	rows, err := db.Query("SELECT date, status, IFNULL(error, '') FROM webhook_attempts WHERE delivery = ? ORDER BY rowid", delivery)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var date int64
+		var status int64
+		var attemptError string
+
+		if err = rows.Scan(&date, &status, &attemptError); err != nil {
+			return err
+		}
+
+		result := "delivered"
+
+		if attemptError != "" {
+			result = attemptError
+		}
+
+		fmt.Println("                  " + formatUnixDate(date) + "  " + result)
+	}
+
+	return rows.Err()
+}
+
 func getSpacing(entrySize int, maxSize int) string {
 	spacing := "  "
 
@@ -138,6 +395,34 @@ func formatInt(i int64) string {
 	return strconv.FormatInt(i, 10)
 }
 
-func getTips(db *sql.DB) (rows *sql.Rows, err error) {
-	return db.Query("SELECT * FROM tips ORDER BY date DESC")
+// Tips that were received before amounts were stored in millisatoshis have only the amount in satoshis
+// If the jar is not empty only the tips for it are selected
+func getTips(db *sql.DB, jar string) (rows *sql.Rows, err error) {
+	query := "SELECT date, IFNULL(amount_msat, amount * 1000), message, IFNULL(keysend, 0) FROM tips"
+
+	if jar != "" {
+		return db.Query(query+" WHERE jar = ? ORDER BY date DESC", jar)
+	}
+
+	return db.Query(query + " ORDER BY date DESC")
+}
+
+func getGoals(db *sql.DB) (rows *sql.Rows, err error) {
+	return db.Query("SELECT goals.id, goals.label, goals.target_msat, goals.start, goals.end, " +
+		"IFNULL(SUM(IFNULL(tips.amount_msat, tips.amount * 1000)), 0), COUNT(tips.rowid) " +
+		"FROM goals LEFT JOIN tips ON tips.goal = goals.id AND tips.date >= goals.start AND (goals.end = 0 OR tips.date < goals.end) " +
+		"GROUP BY goals.id ORDER BY goals.start, goals.id")
+}
+
+func getPayouts(db *sql.DB) (rows *sql.Rows, err error) {
+	return db.Query("SELECT id, created, destination, amount_msat, state, attempts, fee_msat, " +
+		"IFNULL((SELECT error FROM payout_attempts WHERE payout = payouts.id ORDER BY rowid DESC LIMIT 1), '') " +
+		"FROM payouts ORDER BY id DESC")
+}
+
+func getWebhookDeliveries(db *sql.DB) (rows *sql.Rows, err error) {
+	return db.Query("SELECT id, created, url, event, state, attempts, " +
+		"IFNULL((SELECT status FROM webhook_attempts WHERE delivery = webhook_deliveries.id ORDER BY rowid DESC LIMIT 1), 0), " +
+		"IFNULL((SELECT error FROM webhook_attempts WHERE delivery = webhook_deliveries.id ORDER BY rowid DESC LIMIT 1), '') " +
+		"FROM webhook_deliveries ORDER BY id DESC")
 }
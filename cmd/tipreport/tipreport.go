@@ -34,11 +34,18 @@ func main() {
 			Value: getDefaultDatabaseFile(),
 			Usage: "path to database file",
 		},
+		cli.StringFlag{
+			Name:  "jar",
+			Usage: "only show tips for this jar",
+		},
 	}
 
 	app.Commands = []cli.Command{
 		summaryCommand,
 		listCommand,
+		goalsCommand,
+		payoutsCommand,
+		webhooksCommand,
 	}
 
 	err := app.Run(os.Args)
@@ -14,6 +14,7 @@ import (
 	"github.com/michael1011/lightningtip/backends"
 	"github.com/michael1011/lightningtip/database"
 	"github.com/michael1011/lightningtip/notifications"
+	"github.com/michael1011/lightningtip/rates"
 	"github.com/michael1011/lightningtip/version"
 	logging "github.com/op/go-logging"
 )
@@ -36,13 +37,67 @@ const (
 
 	defaultTipExpiry = 3600
 
+	defaultPrivateInvoices = false
+	defaultFallbackAddress = ""
+
+	defaultHoldInvoices = holdModeOff
+	defaultHoldTimeout  = 3600
+
+	defaultTipWall     = false
+	defaultTipWallSize = 10
+
+	defaultTipWallApproval = false
+
+	defaultAdminHost = "localhost:8083"
+
+	defaultMinTip = 1
+	// Tips of any size are allowed by default because payments can be split into multiple HTLCs
+	defaultMaxTip = 0
+
 	defaultReconnectInterval = 0
 	defaultKeepaliveInterval = 0
 
+	defaultBackend = "lnd"
+
 	defaultLndGRPCHost  = "localhost:10009"
 	defaultLndCertFile  = "tls.cert"
 	defaultMacaroonFile = "invoice.macaroon"
 
+	defaultLndRESTHost = "localhost:8080"
+
+	defaultClnRPCFile = "bitcoin/lightning-rpc"
+
+	defaultEclairURL      = "http://localhost:8080"
+	defaultEclairPassword = ""
+
+	defaultLNbitsURL        = ""
+	defaultLNbitsInvoiceKey = ""
+
+	defaultRateProvider = ""
+
+	defaultHTTPRatesURL       = "https://api.coingecko.com/api/v3/simple/price?ids=bitcoin&vs_currencies={currency}"
+	defaultHTTPRatesCacheTime = 60
+
+	defaultStaticRatesFile = "rates.json"
+
+	defaultLNURLURL            = ""
+	defaultLNURLDescription    = "Tip"
+	defaultLNURLCommentAllowed = 255
+
+	defaultPayoutInterval    = 600
+	defaultPayoutMinAmount   = 100
+	defaultPayoutMaxFee      = 1
+	defaultPayoutMinFee      = 10
+	defaultPayoutMaxAttempts = 10
+
+	defaultWebhookSecret        = ""
+	defaultWebhookTimeout       = 10
+	defaultWebhookRetryInterval = 30
+	defaultWebhookMaxAttempts   = 10
+
+	defaultMockSettleDelay = 10
+	defaultMockDebugHost   = "localhost:8082"
+
 	defaultRecipient = ""
 	defaultSender    = ""
 
@@ -57,6 +112,42 @@ type helpOptions struct {
 	ShowVersion bool `long:"version" short:"v" description:"Display version and exit"`
 }
 
+type lnurlOptions struct {
+	Names          []string `long:"name" description:"Name of a Lightning Address which is the part before the @. Can be set multiple times"`
+	URL            string   `long:"url" description:"Public URL under which LightningTip is reachable through a reverse proxy. Defaults to HTTPS with the host of the request"`
+	Description    string   `long:"description" description:"Description that wallets show when paying to a Lightning Address"`
+	CommentAllowed int64    `long:"commentallowed" description:"Maximal length of comments that can be sent along with payments. Set to 0 to disable comments"`
+}
+
+// The connection options of the Lightning implementations can be set multiple times to use multiple nodes
+// of the same implementation. The nth value of every option belongs to the nth node and options that are
+// set fewer times than the first one of their group use their last value for the remaining nodes
+type lndOptions struct {
+	GRPCHosts     []string `long:"grpchost" description:"Host of the gRPC interface of LND. Can be set multiple times to use multiple nodes"`
+	CertFiles     []string `long:"certfile" description:"TLS certificate for the LND gRPC and REST services"`
+	MacaroonFiles []string `long:"macaroonfile" description:"Macaroon file for authentication. Set to an empty string for no macaroon"`
+}
+
+type lndRESTOptions struct {
+	RESTHosts     []string `long:"resthost" description:"Host of the REST interface of LND. HTTPS is used unless the host starts with \"http://\". Can be set multiple times to use multiple nodes"`
+	CertFiles     []string `long:"certfile" description:"TLS certificate for the LND gRPC and REST services. Set to an empty string to trust the certificate authorities of the system"`
+	MacaroonFiles []string `long:"macaroonfile" description:"Macaroon file for authentication. Set to an empty string for no macaroon"`
+}
+
+type clnOptions struct {
+	RPCFiles []string `long:"rpcfile" description:"Path to the JSON-RPC socket of lightningd. Can be set multiple times to use multiple nodes"`
+}
+
+type eclairOptions struct {
+	URLs      []string `long:"url" description:"URL of the HTTP API of Eclair. Can be set multiple times to use multiple nodes"`
+	Passwords []string `long:"password" description:"Password of the HTTP API of Eclair"`
+}
+
+type lnbitsOptions struct {
+	URLs        []string `long:"url" description:"URL of the LNbits instance. Can be set multiple times to use multiple wallets"`
+	InvoiceKeys []string `long:"invoicekey" description:"Invoice/read key of the LNbits wallet"`
+}
+
 type config struct {
 	ConfigFile string `long:"config" description:"Location of the config file"`
 
@@ -75,13 +166,62 @@ type config struct {
 
 	TipExpiry int64 `long:"tipexpiry" description:"Invoice expiry time in seconds"`
 
+	PrivateInvoices bool   `long:"privateinvoices" description:"Add route hints for private channels to invoices"`
+	FallbackAddress string `long:"fallbackaddress" description:"On-chain address added to invoices as fallback"`
+
+	HoldInvoices string   `long:"holdinvoices" description:"Use hold invoices to approve tips before accepting them: off, manual or filter"`
+	HoldTimeout  int64    `long:"holdtimeout" description:"Seconds after which paid hold invoices that were not approved are canceled. Set to 0 to disable"`
+	HoldFilter   []string `long:"holdfilter" description:"Tips with messages that contain this word are declined in the filter mode. Can be set multiple times"`
+
+	Jars []string `long:"jar" description:"Tip jar in the format name:recipient:maxmessagelength. The recipient gets notified via mail about tips for the jar. Can be set multiple times"`
+
+	JarMails []string `long:"jarmail" description:"Setting of the Mail group for one jar in the format jar:setting:value. The settings are sender, server, ssl, user and password. Can be set multiple times"`
+
+	Goals []string `long:"goal" description:"Fundraising goal in the format id:target:start:end:label. The target is in satoshis and the dates are YYYY-MM-DD or empty. Can be set multiple times"`
+
+	TipWall     bool  `long:"tipwall" description:"Show recently received tips publicly via /tips/recent and the EventSource stream"`
+	TipWallSize int64 `long:"tipwallsize" description:"Maximal number of tips returned by /tips/recent"`
+
+	TipWallApproval bool `long:"tipwallapproval" description:"Hide new tips from the tip wall until they are shown via the admin interface"`
+
+	AdminHost  string `long:"adminhost" description:"Host for the admin interface of LightningTip"`
+	AdminToken string `long:"admintoken" description:"Token that has to be sent as bearer token in requests to the admin interface. The admin interface is disabled if it is not set"`
+
+	MinTip     int64   `long:"mintip" description:"Minimal amount of a tip in satoshis"`
+	MaxTip     int64   `long:"maxtip" description:"Maximal amount of a tip in satoshis. Set to 0 for no limit"`
+	TipPresets []int64 `long:"tippreset" description:"Tip amount in satoshis suggested by the frontend. Can be set multiple times"`
+
 	ReconnectInterval int64 `long:"reconnectinterval" description:"Reconnect interval to LND in seconds"`
 	KeepAliveInterval int64 `long:"keepaliveinterval" description:"Send a dummy request to LND to prevent timeouts "`
 
-	LND *backends.LND `group:"LND" namespace:"lnd"`
+	Backend string `long:"backend" description:"Comma separated list of Lightning implementations used as backend: lnd, lndrest, cln, eclair, lnbits or mock"`
+
+	LND *lndOptions `group:"LND" namespace:"lnd"`
+
+	LNDREST *lndRESTOptions `group:"LND REST" namespace:"lndrest"`
+
+	CLN *clnOptions `group:"CLN" namespace:"cln"`
+
+	Eclair *eclairOptions `group:"Eclair" namespace:"eclair"`
+
+	LNbits *lnbitsOptions `group:"LNbits" namespace:"lnbits"`
+
+	Mock *backends.Mock `group:"Mock" namespace:"mock"`
+
+	RateProvider string `long:"rateprovider" description:"Provider of exchange rates for tips denominated in fiat: http or static. Leave empty to accept tips in satoshis only"`
+
+	HTTPRates *rates.HTTP `group:"HTTP Rates" namespace:"httprates"`
+
+	StaticRates *rates.Static `group:"Static Rates" namespace:"staticrates"`
+
+	LNURL *lnurlOptions `group:"LNURL" namespace:"lnurl"`
+
+	Payouts *payoutOptions `group:"Payouts" namespace:"payouts"`
 
 	Mail *notifications.Mail `group:"Mail" namespace:"mail"`
 
+	Webhook *notifications.Webhook `group:"Webhook" namespace:"webhook"`
+
 	Help *helpOptions `group:"Help Options"`
 }
 
@@ -89,6 +229,12 @@ var cfg config
 
 var backend backends.Backend
 
+// Names of the backends in use in the order of preference
+var backendNames []string
+
+// Nil if tips can't be denominated in fiat
+var rateProvider rates.Provider
+
 func initConfig() {
 	cfg = config{
 		ConfigFile: path.Join(getDefaultDataDir(), defaultConfigFile),
@@ -108,13 +254,81 @@ func initConfig() {
 
 		TipExpiry: defaultTipExpiry,
 
+		PrivateInvoices: defaultPrivateInvoices,
+		FallbackAddress: defaultFallbackAddress,
+
+		HoldInvoices: defaultHoldInvoices,
+		HoldTimeout:  defaultHoldTimeout,
+
+		TipWall:     defaultTipWall,
+		TipWallSize: defaultTipWallSize,
+
+		TipWallApproval: defaultTipWallApproval,
+
+		AdminHost: defaultAdminHost,
+
+		MinTip: defaultMinTip,
+		MaxTip: defaultMaxTip,
+
 		ReconnectInterval: defaultReconnectInterval,
 		KeepAliveInterval: defaultKeepaliveInterval,
 
-		LND: &backends.LND{
-			GRPCHost:     defaultLndGRPCHost,
-			CertFile:     path.Join(getDefaultLndDir(), defaultLndCertFile),
-			MacaroonFile: getDefaultMacaroon(),
+		Backend: defaultBackend,
+
+		LND: &lndOptions{
+			GRPCHosts:     []string{defaultLndGRPCHost},
+			CertFiles:     []string{path.Join(getDefaultLndDir(), defaultLndCertFile)},
+			MacaroonFiles: []string{getDefaultMacaroon()},
+		},
+
+		LNDREST: &lndRESTOptions{
+			RESTHosts:     []string{defaultLndRESTHost},
+			CertFiles:     []string{path.Join(getDefaultLndDir(), defaultLndCertFile)},
+			MacaroonFiles: []string{getDefaultMacaroon()},
+		},
+
+		CLN: &clnOptions{
+			RPCFiles: []string{path.Join(getDefaultClnDir(), defaultClnRPCFile)},
+		},
+
+		Eclair: &eclairOptions{
+			URLs:      []string{defaultEclairURL},
+			Passwords: []string{defaultEclairPassword},
+		},
+
+		LNbits: &lnbitsOptions{
+			URLs:        []string{defaultLNbitsURL},
+			InvoiceKeys: []string{defaultLNbitsInvoiceKey},
+		},
+
+		Mock: &backends.Mock{
+			SettleDelay: defaultMockSettleDelay,
+			DebugHost:   defaultMockDebugHost,
+		},
+
+		RateProvider: defaultRateProvider,
+
+		HTTPRates: &rates.HTTP{
+			URL:       defaultHTTPRatesURL,
+			CacheTime: defaultHTTPRatesCacheTime,
+		},
+
+		StaticRates: &rates.Static{
+			File: path.Join(getDefaultDataDir(), defaultStaticRatesFile),
+		},
+
+		LNURL: &lnurlOptions{
+			URL:            defaultLNURLURL,
+			Description:    defaultLNURLDescription,
+			CommentAllowed: defaultLNURLCommentAllowed,
+		},
+
+		Payouts: &payoutOptions{
+			Interval:    defaultPayoutInterval,
+			MinAmount:   defaultPayoutMinAmount,
+			MaxFee:      defaultPayoutMaxFee,
+			MinFee:      defaultPayoutMinFee,
+			MaxAttempts: defaultPayoutMaxAttempts,
 		},
 
 		Mail: &notifications.Mail{
@@ -126,6 +340,13 @@ func initConfig() {
 			SMTPUser:     defaultSTMPUser,
 			SMTPPassword: defaultSTMPPassword,
 		},
+
+		Webhook: &notifications.Webhook{
+			Secret:        defaultWebhookSecret,
+			Timeout:       defaultWebhookTimeout,
+			RetryInterval: defaultWebhookRetryInterval,
+			MaxAttempts:   defaultWebhookMaxAttempts,
+		},
 	}
 
 	// Ignore unknown flags the first time parsing command line flags to prevent showing the unknown flag error twice
@@ -201,11 +422,238 @@ func initConfig() {
 		log.Debug("Initialized log file: " + cfg.LogFile)
 	}
 
+	// Tips have to be at least one satoshi
+	if cfg.MinTip < 1 {
+		cfg.MinTip = 1
+	}
+
+	if cfg.MaxTip < 0 || (cfg.MaxTip > 0 && cfg.MaxTip < cfg.MinTip) {
+		log.Error("Maximal amount of a tip has to be 0 or at least the minimal amount")
+
+		os.Exit(1)
+	}
+
+	cfg.HoldInvoices = strings.ToLower(strings.TrimSpace(cfg.HoldInvoices))
+
+	switch cfg.HoldInvoices {
+	case holdModeOff, holdModeManual, holdModeFilter:
+		// Valid modes
+
+	default:
+		log.Warning("Unknown hold invoice mode \"" + cfg.HoldInvoices + "\". Not using hold invoices")
+
+		cfg.HoldInvoices = holdModeOff
+	}
+
+	for _, value := range cfg.Jars {
+		jar, err := parseJar(value)
+
+		if err != nil {
+			log.Warning("Ignoring invalid jar \"" + value + "\": " + err.Error())
+
+			continue
+		}
+
+		jars[jar.Name] = jar
+	}
+
+	for _, value := range cfg.JarMails {
+		if err := parseJarMail(value); err != nil {
+			log.Warning("Ignoring invalid mail setting of jar \"" + value + "\": " + err.Error())
+		}
+
+	}
+
+	for _, value := range cfg.Goals {
+		goal, err := parseGoal(value)
+
+		if err != nil {
+			log.Warning("Ignoring invalid goal \"" + value + "\": " + err.Error())
+
+			continue
+		}
+
+		goals[goal.ID] = goal
+	}
+
+	// Splits refer to jars which is why they have to be parsed after them
+	initSplits()
+
+	if cfg.Payouts.Interval < 1 {
+		cfg.Payouts.Interval = defaultPayoutInterval
+	}
+
+	if cfg.Webhook.RetryInterval < 1 {
+		cfg.Webhook.RetryInterval = defaultWebhookRetryInterval
+	}
+
+	if len(cfg.Webhook.URLs) > 0 && cfg.Webhook.Secret == "" {
+		log.Warning("No webhook secret set. Receivers of the webhooks can't verify that the events were sent by LightningTip")
+	}
+
+	if cfg.TipWallSize < 1 {
+		cfg.TipWallSize = defaultTipWallSize
+	}
+
+	if cfg.HoldInvoices == holdModeManual && cfg.AdminToken == "" {
+		log.Warning("No admin token set. Tips paid with hold invoices can't be approved and will be canceled after the hold timeout")
+	}
+
+	if cfg.TipWall && cfg.TipWallApproval && cfg.AdminToken == "" {
+		log.Warning("No admin token set. Tips can't be approved and will not show up on the tip wall")
+	}
+
 	database.UseLogger(*log)
 	backends.UseLogger(*log)
 	notifications.UseLogger(*log)
+	rates.UseLogger(*log)
+
+	var names []string
+	var selected []backends.Backend
+
+	holdInvoicesSupported := false
+
+	for _, name := range strings.Split(cfg.Backend, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if name == "" {
+			continue
+		}
+
+		instanceNames, instances := getBackends(name)
+
+		if len(instances) == 0 {
+			log.Error("Unknown backend \"" + name + "\"")
+
+			os.Exit(1)
+		}
+
+		names = append(names, instanceNames...)
+		selected = append(selected, instances...)
 
-	backend = cfg.LND
+		holdInvoicesSupported = holdInvoicesSupported || holdInvoiceBackends[name]
+	}
+
+	switch len(selected) {
+	case 0:
+		log.Error("No backend configured")
+
+		os.Exit(1)
+
+	case 1:
+		backend = selected[0]
+
+	default:
+		log.Info("Using backends with failover: " + strings.Join(names, ", "))
+
+		backend = backends.NewFailover(names, selected, cfg.ReconnectInterval)
+	}
+
+	backendNames = names
+
+	// Tips could not be paid at all because no invoices could be created
+	if cfg.HoldInvoices != holdModeOff && !holdInvoicesSupported {
+		log.Error("None of the backends supports hold invoices. Set \"holdinvoices\" to \"off\" or use a backend that does")
+
+		os.Exit(1)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(cfg.RateProvider)) {
+	case "":
+		// Tips can be denominated in satoshis only
+
+	case "http":
+		rateProvider = cfg.HTTPRates
+
+	case "static":
+		rateProvider = cfg.StaticRates
+
+	default:
+		log.Warning("Unknown rate provider \"" + cfg.RateProvider + "\". Tips can't be denominated in fiat")
+	}
+}
+
+// The backends that can create hold invoices
+var holdInvoiceBackends = map[string]bool{
+	"lnd":     true,
+	"lndrest": true,
+	"mock":    true,
+}
+
+// Gets all nodes of a Lightning implementation. If there are multiple nodes their names contain the host
+// to tell them apart
+func getBackends(implementation string) (names []string, instances []backends.Backend) {
+	add := func(host string, count int, instance backends.Backend) {
+		name := implementation
+
+		if count > 1 {
+			name += "@" + host
+		}
+
+		names = append(names, name)
+		instances = append(instances, instance)
+	}
+
+	switch implementation {
+	case "lnd":
+		for i, host := range cfg.LND.GRPCHosts {
+			add(host, len(cfg.LND.GRPCHosts), &backends.LND{
+				GRPCHost:     host,
+				CertFile:     getNodeOption(cfg.LND.CertFiles, i),
+				MacaroonFile: getNodeOption(cfg.LND.MacaroonFiles, i),
+			})
+		}
+
+	case "lndrest":
+		for i, host := range cfg.LNDREST.RESTHosts {
+			add(host, len(cfg.LNDREST.RESTHosts), &backends.LNDREST{
+				RESTHost:     host,
+				CertFile:     getNodeOption(cfg.LNDREST.CertFiles, i),
+				MacaroonFile: getNodeOption(cfg.LNDREST.MacaroonFiles, i),
+			})
+		}
+
+	case "cln":
+		for _, rpcFile := range cfg.CLN.RPCFiles {
+			add(rpcFile, len(cfg.CLN.RPCFiles), &backends.CLN{
+				RPCFile: rpcFile,
+			})
+		}
+
+	case "eclair":
+		for i, url := range cfg.Eclair.URLs {
+			add(url, len(cfg.Eclair.URLs), &backends.Eclair{
+				URL:      url,
+				Password: getNodeOption(cfg.Eclair.Passwords, i),
+			})
+		}
+
+	case "lnbits":
+		for i, url := range cfg.LNbits.URLs {
+			add(url, len(cfg.LNbits.URLs), &backends.LNbits{
+				URL:        url,
+				InvoiceKey: getNodeOption(cfg.LNbits.InvoiceKeys, i),
+			})
+		}
+
+	case "mock":
+		add("", 1, cfg.Mock)
+	}
+
+	return names, instances
+}
+
+// Options that are set fewer times than there are nodes use their last value for the remaining nodes
+func getNodeOption(values []string, index int) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	if index >= len(values) {
+		return values[len(values)-1]
+	}
+
+	return values[index]
 }
 
 func getDefaultDataDir() (dir string) {
@@ -264,6 +712,23 @@ func getDefaultLndDir() (dir string) {
 	return cleanPath(dir)
 }
 
+func getDefaultClnDir() (dir string) {
+	homeDir := getHomeDir()
+
+	switch runtime.GOOS {
+	case "darwin":
+		fallthrough
+
+	case "windows":
+		dir = path.Join(homeDir, "Lightning")
+
+	default:
+		dir = path.Join(homeDir, ".lightning")
+	}
+
+	return cleanPath(dir)
+}
+
 func getHomeDir() (dir string) {
 	usr, err := user.Current()
 
@@ -11,23 +11,177 @@ import (
 
 var db *sql.DB
 
+// PendingInvoice is an invoice that was not settled yet
+type PendingInvoice struct {
+	Invoice    string
+	RHash      string
+	AmountMsat int64
+	Message    string
+	Nickname   string
+	Expiry     time.Time
+
+	// ID of the goal the tip is attributed to
+	Goal string
+
+	// Name of the jar the tip is for
+	Jar string
+
+	// Only set if the tip was denominated in fiat. The rate is the price of one bitcoin in the currency
+	Fiat     float64
+	Currency string
+	Rate     float64
+
+	// Only set for hold invoices which have to be settled with it
+	Preimage string
+}
+
+// Invoice is an invoice with its current state
+type Invoice struct {
+	PendingInvoice
+
+	State      string
+	AcceptDate time.Time
+	SettleDate time.Time
+}
+
+// Tip is a received tip
+type Tip struct {
+	ID         int64
+	Date       time.Time
+	AmountMsat int64
+	Message    string
+	Nickname   string
+	Goal       string
+	Jar        string
+
+	Fiat     float64
+	Currency string
+	Rate     float64
+
+	// Empty for tips that were received before payment hashes were stored
+	RHash   string
+	Keysend bool
+	Hidden  bool
+}
+
+// TipFilter restricts which tips are returned by GetTips. Fields with their zero value don't restrict anything
+type TipFilter struct {
+	From time.Time
+	To   time.Time
+
+	MinAmountMsat int64
+	MaxAmountMsat int64
+
+	// Only tips whose message contains this text
+	Message string
+
+	// Only tips for this jar
+	Jar string
+
+	// Only the tip with this ID
+	ID int64
+
+	ExcludeHidden bool
+
+	Limit  int64
+	Offset int64
+}
+
+// Goal is a fundraising goal that tips can be attributed to
+type Goal struct {
+	ID         string
+	Label      string
+	TargetMsat int64
+
+	// Zero if the goal has no start or end
+	Start time.Time
+	End   time.Time
+}
+
+// States of invoices
+const (
+	InvoicePending = "pending"
+	InvoiceSettled = "settled"
+	InvoiceExpired = "expired"
+
+	// Hold invoices that were paid but are neither settled nor canceled yet
+	InvoiceAccepted = "accepted"
+	InvoiceCanceled = "canceled"
+)
+
+// Rows that were created before the "amount_msat" column was added have only the amount in satoshis
+const amountMsatColumn = "IFNULL(amount_msat, amount * 1000)"
+
+// The columns of the invoices table that are read into a PendingInvoice by scanPendingInvoice
+const pendingInvoiceColumns = "invoice, rhash, " + amountMsatColumn + ", message, expiry, " +
+	"IFNULL(fiat, 0), IFNULL(currency, ''), IFNULL(rate, 0), IFNULL(preimage, ''), IFNULL(nickname, ''), IFNULL(goal, ''), IFNULL(jar, '')"
+
 // InitDatabase is initializing the database
 func InitDatabase(databaseFile string) (err error) {
 	db, err = sql.Open("sqlite3", databaseFile)
 
 	if err == nil {
+		// SQLite doesn't handle concurrent writes well
+		db.SetMaxOpenConns(1)
+
 		db.Exec("CREATE TABLE IF NOT EXISTS `tips` (`date` INTEGER, `amount` INTEGER, `message` VARCHAR)")
+		db.Exec("CREATE TABLE IF NOT EXISTS `invoices` (`invoice` VARCHAR PRIMARY KEY, `rhash` VARCHAR, `amount` INTEGER, `message` VARCHAR, `expiry` INTEGER)")
+		db.Exec("CREATE TABLE IF NOT EXISTS `settle_indexes` (`backend` VARCHAR PRIMARY KEY, `settle_index` INTEGER)")
+
+		// Columns added after the table was created. Adding them fails if they exist already which can be ignored
+		db.Exec("ALTER TABLE `invoices` ADD COLUMN `state` VARCHAR DEFAULT '" + InvoicePending + "'")
+		db.Exec("ALTER TABLE `invoices` ADD COLUMN `settle_date` INTEGER DEFAULT 0")
+
+		// The "amount" columns are still set to the amount in whole satoshis for compatibility
+		db.Exec("ALTER TABLE `invoices` ADD COLUMN `amount_msat` INTEGER")
+		db.Exec("ALTER TABLE `tips` ADD COLUMN `amount_msat` INTEGER")
+
+		for _, table := range []string{"tips", "invoices"} {
+			db.Exec("ALTER TABLE `" + table + "` ADD COLUMN `fiat` REAL")
+			db.Exec("ALTER TABLE `" + table + "` ADD COLUMN `currency` VARCHAR")
+			db.Exec("ALTER TABLE `" + table + "` ADD COLUMN `rate` REAL")
+		}
+
+		db.Exec("ALTER TABLE `tips` ADD COLUMN `rhash` VARCHAR")
+		db.Exec("ALTER TABLE `tips` ADD COLUMN `keysend` INTEGER DEFAULT 0")
+
+		db.Exec("ALTER TABLE `invoices` ADD COLUMN `preimage` VARCHAR")
+		db.Exec("ALTER TABLE `invoices` ADD COLUMN `accept_date` INTEGER DEFAULT 0")
+
+		// Hidden tips are kept in the database but not shown publicly
+		db.Exec("ALTER TABLE `tips` ADD COLUMN `hidden` INTEGER DEFAULT 0")
+
+		for _, table := range []string{"tips", "invoices"} {
+			db.Exec("ALTER TABLE `" + table + "` ADD COLUMN `nickname` VARCHAR")
+			db.Exec("ALTER TABLE `" + table + "` ADD COLUMN `goal` VARCHAR")
+			db.Exec("ALTER TABLE `" + table + "` ADD COLUMN `jar` VARCHAR")
+		}
+
+		// Public requests look up invoices and tips by their payment hash and must not scan the whole tables
+		// Databases with the same payment hash for multiple invoices can't have a unique index
+		if _, indexErr := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS `invoices_rhash` ON `invoices` (`rhash`)"); indexErr != nil {
+			log.Warning("Could not create unique index for payment hashes of invoices: " + fmt.Sprint(indexErr))
+
+			db.Exec("CREATE INDEX IF NOT EXISTS `invoices_rhash_duplicates` ON `invoices` (`rhash`)")
+		}
+
+		db.Exec("CREATE INDEX IF NOT EXISTS `tips_rhash` ON `tips` (`rhash`)")
+
+		db.Exec("CREATE TABLE IF NOT EXISTS `goals` (`id` VARCHAR PRIMARY KEY, `label` VARCHAR, `target_msat` INTEGER, `start` INTEGER, `end` INTEGER)")
+
+		initPayoutTables()
+		initWebhookTables()
 	}
 
 	return err
 }
 
 // AddSettledInvoice is adding a settled invoice to the database
-func AddSettledInvoice(amount int64, message string) {
-	stmt, err := db.Prepare("INSERT INTO tips(date, amount, message) values(?, ?, ?)")
+func AddSettledInvoice(amountMsat int64, message string) {
+	stmt, err := db.Prepare("INSERT INTO tips(date, amount, amount_msat, message) values(?, ?, ?, ?)")
 
 	if err == nil {
-		_, err = stmt.Exec(time.Now().Unix(), amount, message)
+		_, err = stmt.Exec(time.Now().Unix(), amountMsat/1000, amountMsat, message)
 	}
 
 	if err == nil {
@@ -38,3 +192,488 @@ func AddSettledInvoice(amount int64, message string) {
 	}
 
 }
+
+// AddPendingInvoice is adding an invoice that was not settled yet to the database
+func AddPendingInvoice(invoice PendingInvoice) {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO invoices(invoice, rhash, amount, amount_msat, message, expiry, fiat, currency, rate, preimage, nickname, goal, jar) "+
+			"values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		invoice.Invoice,
+		invoice.RHash,
+		invoice.AmountMsat/1000,
+		invoice.AmountMsat,
+		invoice.Message,
+		invoice.Expiry.Unix(),
+		nullFiat(invoice.Fiat),
+		nullString(invoice.Currency),
+		nullFiat(invoice.Rate),
+		nullString(invoice.Preimage),
+		nullString(invoice.Nickname),
+		nullString(invoice.Goal),
+		nullString(invoice.Jar),
+	)
+
+	if err != nil {
+		log.Error("Could not insert pending invoice into database: " + fmt.Sprint(err))
+	}
+
+}
+
+// ExpirePendingInvoice is marking an invoice in the database as expired
+func ExpirePendingInvoice(invoice string) {
+	_, err := db.Exec("UPDATE invoices SET state = ? WHERE invoice = ? AND state = ?", InvoiceExpired, invoice, InvoicePending)
+
+	if err != nil {
+		log.Error("Could not update pending invoice in database: " + fmt.Sprint(err))
+	}
+
+}
+
+// AcceptHoldInvoice is marking a hold invoice that was paid as accepted
+func AcceptHoldInvoice(invoice string) {
+	_, err := db.Exec(
+		"UPDATE invoices SET state = ?, accept_date = ? WHERE invoice = ?",
+		InvoiceAccepted,
+		time.Now().Unix(),
+		invoice,
+	)
+
+	if err != nil {
+		log.Error("Could not update hold invoice in database: " + fmt.Sprint(err))
+	}
+
+}
+
+// CancelHoldInvoice is marking a hold invoice as canceled
+func CancelHoldInvoice(invoice string) {
+	_, err := db.Exec("UPDATE invoices SET state = ? WHERE invoice = ?", InvoiceCanceled, invoice)
+
+	if err != nil {
+		log.Error("Could not update hold invoice in database: " + fmt.Sprint(err))
+	}
+
+}
+
+// SettlePendingInvoice is adding a settled invoice to the tips and marking it as settled
+// Both happen in one transaction to make sure the tip is neither lost nor recorded twice
+// Only pending, expired and accepted invoices are settled and settled is false if the invoice was settled
+// already or could not be recorded. Hidden tips are not shown publicly
+func SettlePendingInvoice(invoice PendingInvoice, hidden bool) (id int64, settled bool) {
+	tx, err := db.Begin()
+
+	if err == nil {
+		now := time.Now().Unix()
+
+		var result sql.Result
+
+		result, err = tx.Exec(
+			"UPDATE invoices SET state = ?, settle_date = ? WHERE invoice = ? AND state IN (?, ?, ?)",
+			InvoiceSettled,
+			now,
+			invoice.Invoice,
+			InvoicePending,
+			InvoiceExpired,
+			InvoiceAccepted,
+		)
+
+		if err == nil {
+			var rows int64
+
+			rows, err = result.RowsAffected()
+			settled = rows > 0
+		}
+
+		if err == nil && !settled {
+			tx.Rollback()
+
+			return 0, false
+		}
+
+		if err == nil {
+			result, err = tx.Exec(
+				"INSERT INTO tips(date, amount, amount_msat, message, fiat, currency, rate, rhash, nickname, goal, jar, hidden) "+
+					"values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+				now,
+				invoice.AmountMsat/1000,
+				invoice.AmountMsat,
+				invoice.Message,
+				nullFiat(invoice.Fiat),
+				nullString(invoice.Currency),
+				nullFiat(invoice.Rate),
+				invoice.RHash,
+				nullString(invoice.Nickname),
+				nullString(invoice.Goal),
+				nullString(invoice.Jar),
+				hidden,
+			)
+		}
+
+		if err == nil {
+			id, err = result.LastInsertId()
+		}
+
+		if err == nil {
+			err = tx.Commit()
+
+		} else {
+			tx.Rollback()
+		}
+
+	}
+
+	if err != nil {
+		log.Error("Could not insert into database: " + fmt.Sprint(err))
+
+		return 0, false
+	}
+
+	return id, true
+}
+
+// AddKeysendTip is adding a tip that was received with a spontaneous payment instead of an invoice
+// Payments are recorded only once per payment hash and added is false if it was recorded already
+func AddKeysendTip(rHash string, amountMsat int64, message string, hidden bool) (id int64, added bool) {
+	result, err := db.Exec(
+		"INSERT INTO tips(date, amount, amount_msat, message, rhash, keysend, hidden) "+
+			"SELECT ?, ?, ?, ?, ?, 1, ? WHERE NOT EXISTS (SELECT 1 FROM tips WHERE rhash = ?)",
+		time.Now().Unix(),
+		amountMsat/1000,
+		amountMsat,
+		message,
+		rHash,
+		hidden,
+		rHash,
+	)
+
+	if err == nil {
+		var rows int64
+
+		rows, err = result.RowsAffected()
+		added = rows > 0
+	}
+
+	if err == nil && added {
+		id, err = result.LastInsertId()
+	}
+
+	if err != nil {
+		log.Error("Could not insert keysend tip into database: " + fmt.Sprint(err))
+	}
+
+	return id, added
+}
+
+// GetTips gets the tips that match the filter with the most recent first
+func GetTips(filter TipFilter) (tips []Tip, err error) {
+	query := "SELECT rowid, date, " + amountMsatColumn + ", IFNULL(message, ''), IFNULL(nickname, ''), IFNULL(goal, ''), IFNULL(jar, ''), " +
+		"IFNULL(fiat, 0), IFNULL(currency, ''), IFNULL(rate, 0), IFNULL(rhash, ''), IFNULL(keysend, 0), IFNULL(hidden, 0) FROM tips WHERE 1 = 1"
+
+	var args []interface{}
+
+	if !filter.From.IsZero() {
+		query += " AND date >= ?"
+		args = append(args, filter.From.Unix())
+	}
+
+	if !filter.To.IsZero() {
+		query += " AND date <= ?"
+		args = append(args, filter.To.Unix())
+	}
+
+	if filter.MinAmountMsat > 0 {
+		query += " AND " + amountMsatColumn + " >= ?"
+		args = append(args, filter.MinAmountMsat)
+	}
+
+	if filter.MaxAmountMsat > 0 {
+		query += " AND " + amountMsatColumn + " <= ?"
+		args = append(args, filter.MaxAmountMsat)
+	}
+
+	if filter.Message != "" {
+		query += " AND INSTR(LOWER(message), LOWER(?)) > 0"
+		args = append(args, filter.Message)
+	}
+
+	if filter.Jar != "" {
+		query += " AND jar = ?"
+		args = append(args, filter.Jar)
+	}
+
+	if filter.ID != 0 {
+		query += " AND rowid = ?"
+		args = append(args, filter.ID)
+	}
+
+	if filter.ExcludeHidden {
+		query += " AND IFNULL(hidden, 0) = 0"
+	}
+
+	query += " ORDER BY date DESC, rowid DESC"
+
+	// SQLite requires a limit if there is an offset and -1 means that there is none
+	if filter.Limit > 0 || filter.Offset > 0 {
+		limit := filter.Limit
+
+		if limit <= 0 {
+			limit = -1
+		}
+
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, filter.Offset)
+	}
+
+	rows, err := db.Query(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var tip Tip
+		var date int64
+
+		err = rows.Scan(
+			&tip.ID,
+			&date,
+			&tip.AmountMsat,
+			&tip.Message,
+			&tip.Nickname,
+			&tip.Goal,
+			&tip.Jar,
+			&tip.Fiat,
+			&tip.Currency,
+			&tip.Rate,
+			&tip.RHash,
+			&tip.Keysend,
+			&tip.Hidden,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tip.Date = time.Unix(date, 0)
+
+		tips = append(tips, tip)
+	}
+
+	return tips, rows.Err()
+}
+
+// DeleteTip deletes a tip from the database. Found is false if there is no tip with that ID
+func DeleteTip(id int64) (found bool, err error) {
+	result, err := db.Exec("DELETE FROM tips WHERE rowid = ?", id)
+
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+
+	return rows > 0, err
+}
+
+// HideTip hides a tip from the public or shows it again. Found is false if there is no tip with that ID
+func HideTip(id int64, hidden bool) (found bool, err error) {
+	result, err := db.Exec("UPDATE tips SET hidden = ? WHERE rowid = ?", hidden, id)
+
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+
+	return rows > 0, err
+}
+
+// SaveGoal adds a goal to the database or updates it
+func SaveGoal(goal Goal) error {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO goals(id, label, target_msat, start, end) values(?, ?, ?, ?, ?)",
+		goal.ID,
+		goal.Label,
+		goal.TargetMsat,
+		unixOrZero(goal.Start),
+		unixOrZero(goal.End),
+	)
+
+	return err
+}
+
+// GetGoalProgress gets the sum of the tips attributed to a goal and how many there are.
+// Only tips that were settled between the start and the end of the goal count
+func GetGoalProgress(goal Goal) (raisedMsat int64, tips int64, err error) {
+	end := unixOrZero(goal.End)
+
+	err = db.QueryRow(
+		"SELECT IFNULL(SUM("+amountMsatColumn+"), 0), COUNT(*) FROM tips WHERE goal = ? AND date >= ? AND (? = 0 OR date < ?)",
+		goal.ID,
+		unixOrZero(goal.Start),
+		end,
+		end,
+	).Scan(&raisedMsat, &tips)
+
+	return raisedMsat, tips, err
+}
+
+// GetPendingInvoices gets all invoices that were not settled yet
+func GetPendingInvoices() (invoices []PendingInvoice, err error) {
+	return queryPendingInvoices("state = ?", InvoicePending)
+}
+
+// GetExpiredInvoices gets the invoices that expired after the given time without being settled
+func GetExpiredInvoices(since time.Time) (invoices []PendingInvoice, err error) {
+	return queryPendingInvoices("state = ? AND expiry > ?", InvoiceExpired, since.Unix())
+}
+
+func queryPendingInvoices(where string, args ...interface{}) (invoices []PendingInvoice, err error) {
+	rows, err := db.Query("SELECT "+pendingInvoiceColumns+" FROM invoices WHERE "+where, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var invoice PendingInvoice
+
+		err = scanPendingInvoice(rows, &invoice)
+
+		if err != nil {
+			return nil, err
+		}
+
+		invoices = append(invoices, invoice)
+	}
+
+	return invoices, rows.Err()
+}
+
+// GetAcceptedInvoices gets all hold invoices that were paid but are neither settled nor canceled
+func GetAcceptedInvoices() (invoices []Invoice, err error) {
+	rows, err := db.Query("SELECT "+invoiceColumns+" FROM invoices WHERE state = ?", InvoiceAccepted)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var invoice Invoice
+
+		err = scanInvoice(rows, &invoice)
+
+		if err != nil {
+			return nil, err
+		}
+
+		invoices = append(invoices, invoice)
+	}
+
+	return invoices, rows.Err()
+}
+
+// GetInvoice gets an invoice by its payment hash. If there is no such invoice sql.ErrNoRows is returned
+func GetInvoice(rHash string) (invoice Invoice, err error) {
+	err = scanInvoice(db.QueryRow("SELECT "+invoiceColumns+" FROM invoices WHERE rhash = ?", rHash), &invoice)
+
+	return invoice, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Scans the columns in pendingInvoiceColumns and the additional destinations after them
+func scanPendingInvoice(row scanner, invoice *PendingInvoice, additional ...interface{}) error {
+	var expiry int64
+
+	destinations := []interface{}{
+		&invoice.Invoice,
+		&invoice.RHash,
+		&invoice.AmountMsat,
+		&invoice.Message,
+		&expiry,
+		&invoice.Fiat,
+		&invoice.Currency,
+		&invoice.Rate,
+		&invoice.Preimage,
+		&invoice.Nickname,
+		&invoice.Goal,
+		&invoice.Jar,
+	}
+
+	err := row.Scan(append(destinations, additional...)...)
+
+	if err == nil {
+		invoice.Expiry = time.Unix(expiry, 0)
+	}
+
+	return err
+}
+
+const invoiceColumns = pendingInvoiceColumns + ", state, IFNULL(accept_date, 0), settle_date"
+
+func scanInvoice(row scanner, invoice *Invoice) error {
+	var acceptDate int64
+	var settleDate int64
+
+	err := scanPendingInvoice(row, &invoice.PendingInvoice, &invoice.State, &acceptDate, &settleDate)
+
+	if err != nil {
+		return err
+	}
+
+	if acceptDate != 0 {
+		invoice.AcceptDate = time.Unix(acceptDate, 0)
+	}
+
+	if settleDate != 0 {
+		invoice.SettleDate = time.Unix(settleDate, 0)
+	}
+
+	return err
+}
+
+func unixOrZero(date time.Time) int64 {
+	if date.IsZero() {
+		return 0
+	}
+
+	return date.Unix()
+}
+
+// Tips that are not denominated in fiat have NULL in the fiat columns
+func nullFiat(value float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: value, Valid: value != 0}
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// SettleIndexStore persists the settle indexes of the subscriptions of the backends in the database
+type SettleIndexStore struct{}
+
+// GetSettleIndex gets the settle index of a subscription or 0 if there is none
+func (store SettleIndexStore) GetSettleIndex(key string) (index uint64, err error) {
+	err = db.QueryRow("SELECT settle_index FROM settle_indexes WHERE backend = ?", key).Scan(&index)
+
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return index, err
+}
+
+// SetSettleIndex sets the settle index of a subscription
+func (store SettleIndexStore) SetSettleIndex(key string, index uint64) error {
+	_, err := db.Exec("INSERT OR REPLACE INTO settle_indexes(backend, settle_index) values(?, ?)", key, index)
+
+	return err
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Checks whether SQLite uses an index for a query instead of scanning the whole table
+func usesIndex(t *testing.T, query string) bool {
+	rows, err := db.Query("EXPLAIN QUERY PLAN "+query, "rhash")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	var plan []string
+
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+
+		if err = rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatal(err)
+		}
+
+		plan = append(plan, detail)
+	}
+
+	return strings.Contains(strings.Join(plan, "\n"), "INDEX")
+}
+
+func TestPaymentHashIndexes(t *testing.T) {
+	defer setUpDatabase(t)()
+
+	for _, query := range []string{
+		"SELECT " + invoiceColumns + " FROM invoices WHERE rhash = ?",
+		"SELECT rowid FROM tips WHERE rhash = ?",
+	} {
+		if !usesIndex(t, query) {
+			t.Errorf("query does not use an index: %s", query)
+		}
+
+	}
+
+}
+
+func TestGetGoalProgress(t *testing.T) {
+	defer setUpDatabase(t)()
+
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	// Tips before the start and after the end were not raised for the goal
+	tips := []struct {
+		date time.Time
+		goal string
+	}{
+		{start.Add(-time.Second), "spring"},
+		{start, "spring"},
+		{end.Add(-time.Second), "spring"},
+		{end, "spring"},
+		{start.Add(time.Hour), "summer"},
+	}
+
+	for _, tip := range tips {
+		_, err := db.Exec("INSERT INTO tips(date, amount, amount_msat, goal) values(?, ?, ?, ?)", tip.date.Unix(), 1, 1000, tip.goal)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+	}
+
+	goals := []struct {
+		goal       Goal
+		raisedMsat int64
+	}{
+		{Goal{ID: "spring", Start: start, End: end}, 2000},
+		{Goal{ID: "spring", Start: start}, 3000},
+		{Goal{ID: "spring", End: end}, 3000},
+		{Goal{ID: "spring"}, 4000},
+		{Goal{ID: "autumn"}, 0},
+	}
+
+	for _, test := range goals {
+		raisedMsat, count, err := GetGoalProgress(test.goal)
+
+		if err != nil || raisedMsat != test.raisedMsat || count != test.raisedMsat/1000 {
+			t.Errorf("unexpected progress %d from %d tips of goal %v: %v", raisedMsat, count, test.goal, err)
+		}
+
+	}
+
+}
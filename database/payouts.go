@@ -0,0 +1,329 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PayoutShare is the part of a tip that is paid out to a collaborator
+type PayoutShare struct {
+	Destination string
+	AmountMsat  int64
+}
+
+// Payout is a payment of the shares of multiple tips to the same destination
+type Payout struct {
+	ID          int64
+	Destination string
+	AmountMsat  int64
+	State       string
+	Created     time.Time
+	Attempts    int64
+	NextAttempt time.Time
+	FeeMsat     int64
+	Preimage    string
+	PaidDate    time.Time
+}
+
+// PayoutAttempt is the result of sending a payout. Error is empty if the payout was sent successfully
+type PayoutAttempt struct {
+	Payout   int64
+	Date     time.Time
+	FeeMsat  int64
+	Preimage string
+	Error    string
+}
+
+// States of payouts
+const (
+	PayoutPending = "pending"
+	PayoutPaid    = "paid"
+	PayoutFailed  = "failed"
+
+	// Payouts are in this state while they are being sent. If LightningTip stops in the meantime it is
+	// unknown whether they were paid
+	PayoutSending = "sending"
+)
+
+const payoutColumns = "id, destination, amount_msat, state, created, attempts, next_attempt, fee_msat, IFNULL(preimage, ''), paid_date"
+
+func initPayoutTables() {
+	// Shares are not assigned to a payout until enough of them for the same destination were collected
+	db.Exec("CREATE TABLE IF NOT EXISTS `payout_shares` (`tip` INTEGER, `destination` VARCHAR, `amount_msat` INTEGER, `payout` INTEGER)")
+
+	db.Exec("CREATE TABLE IF NOT EXISTS `payouts` (`id` INTEGER PRIMARY KEY AUTOINCREMENT, `destination` VARCHAR, " +
+		"`amount_msat` INTEGER, `state` VARCHAR, `created` INTEGER, `attempts` INTEGER DEFAULT 0, `next_attempt` INTEGER, " +
+		"`fee_msat` INTEGER DEFAULT 0, `preimage` VARCHAR, `paid_date` INTEGER DEFAULT 0)")
+
+	db.Exec("CREATE TABLE IF NOT EXISTS `payout_attempts` (`payout` INTEGER, `date` INTEGER, `fee_msat` INTEGER, `preimage` VARCHAR, `error` VARCHAR)")
+}
+
+// AddPayoutShares adds the shares of a tip that have to be paid out
+func AddPayoutShares(tip int64, shares []PayoutShare) error {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	for _, share := range shares {
+		_, err = tx.Exec(
+			"INSERT INTO payout_shares(tip, destination, amount_msat) values(?, ?, ?)",
+			tip,
+			share.Destination,
+			share.AmountMsat,
+		)
+
+		if err != nil {
+			tx.Rollback()
+
+			return err
+		}
+
+	}
+
+	return tx.Commit()
+}
+
+// BatchPayoutShares creates a payout for every destination whose shares that are not assigned to a payout yet
+// sum up to at least the minimal amount
+func BatchPayoutShares(minAmountMsat int64) (payouts int, err error) {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(
+		"SELECT destination, SUM(amount_msat) FROM payout_shares WHERE payout IS NULL "+
+			"GROUP BY destination HAVING SUM(amount_msat) >= ?",
+		minAmountMsat,
+	)
+
+	if err != nil {
+		tx.Rollback()
+
+		return 0, err
+	}
+
+	var batches []PayoutShare
+
+	for rows.Next() {
+		var batch PayoutShare
+
+		if err = rows.Scan(&batch.Destination, &batch.AmountMsat); err != nil {
+			break
+		}
+
+		batches = append(batches, batch)
+	}
+
+	rows.Close()
+
+	if err == nil {
+		err = rows.Err()
+	}
+
+	now := time.Now().Unix()
+
+	for _, batch := range batches {
+		if err != nil {
+			break
+		}
+
+		var result sql.Result
+
+		result, err = tx.Exec(
+			"INSERT INTO payouts(destination, amount_msat, state, created, next_attempt) values(?, ?, ?, ?, ?)",
+			batch.Destination,
+			batch.AmountMsat,
+			PayoutPending,
+			now,
+			now,
+		)
+
+		var id int64
+
+		if err == nil {
+			id, err = result.LastInsertId()
+		}
+
+		if err == nil {
+			_, err = tx.Exec("UPDATE payout_shares SET payout = ? WHERE payout IS NULL AND destination = ?", id, batch.Destination)
+		}
+
+	}
+
+	if err != nil {
+		tx.Rollback()
+
+		return 0, err
+	}
+
+	return len(batches), tx.Commit()
+}
+
+// GetDuePayouts gets the pending payouts whose next attempt is due
+func GetDuePayouts(now time.Time) (payouts []Payout, err error) {
+	return queryPayouts("WHERE state = ? AND next_attempt <= ? ORDER BY id", PayoutPending, now.Unix())
+}
+
+func queryPayouts(where string, args ...interface{}) (payouts []Payout, err error) {
+	rows, err := db.Query("SELECT "+payoutColumns+" FROM payouts "+where, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var payout Payout
+		var created int64
+		var nextAttempt int64
+		var paidDate int64
+
+		err = rows.Scan(
+			&payout.ID,
+			&payout.Destination,
+			&payout.AmountMsat,
+			&payout.State,
+			&created,
+			&payout.Attempts,
+			&nextAttempt,
+			&payout.FeeMsat,
+			&payout.Preimage,
+			&paidDate,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		payout.Created = time.Unix(created, 0)
+		payout.NextAttempt = time.Unix(nextAttempt, 0)
+
+		if paidDate != 0 {
+			payout.PaidDate = time.Unix(paidDate, 0)
+		}
+
+		payouts = append(payouts, payout)
+	}
+
+	return payouts, rows.Err()
+}
+
+// GetPayout gets a payout by its ID
+func GetPayout(id int64) (payout Payout, err error) {
+	payouts, err := queryPayouts("WHERE id = ?", id)
+
+	if err == nil && len(payouts) == 0 {
+		err = sql.ErrNoRows
+	}
+
+	if err != nil {
+		return payout, err
+	}
+
+	return payouts[0], nil
+}
+
+// StartPayoutAttempt marks a payout as being sent
+func StartPayoutAttempt(id int64) error {
+	_, err := db.Exec("UPDATE payouts SET state = ? WHERE id = ?", PayoutSending, id)
+
+	return err
+}
+
+// RecordPayoutAttempt records the result of sending a payout and sets its new state
+// The next attempt is only relevant if the new state is pending
+func RecordPayoutAttempt(attempt PayoutAttempt, state string, nextAttempt time.Time) error {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO payout_attempts(payout, date, fee_msat, preimage, error) values(?, ?, ?, ?, ?)",
+		attempt.Payout,
+		attempt.Date.Unix(),
+		attempt.FeeMsat,
+		nullString(attempt.Preimage),
+		nullString(attempt.Error),
+	)
+
+	if err == nil {
+		var paidDate int64
+
+		if state == PayoutPaid {
+			paidDate = attempt.Date.Unix()
+		}
+
+		_, err = tx.Exec(
+			"UPDATE payouts SET state = ?, attempts = attempts + 1, next_attempt = ?, fee_msat = ?, preimage = ?, paid_date = ? "+
+				"WHERE id = ?",
+			state,
+			nextAttempt.Unix(),
+			attempt.FeeMsat,
+			nullString(attempt.Preimage),
+			paidDate,
+			attempt.Payout,
+		)
+	}
+
+	if err != nil {
+		tx.Rollback()
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FailInterruptedPayouts marks payouts that were being sent when LightningTip stopped as failed
+// Retrying them could pay them twice which is why they have to be checked manually
+func FailInterruptedPayouts() (interrupted []Payout, err error) {
+	rows, err := db.Query("SELECT id, destination, amount_msat FROM payouts WHERE state = ?", PayoutSending)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var payout Payout
+
+		if err = rows.Scan(&payout.ID, &payout.Destination, &payout.AmountMsat); err != nil {
+			break
+		}
+
+		interrupted = append(interrupted, payout)
+	}
+
+	rows.Close()
+
+	if err == nil {
+		err = rows.Err()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	for _, payout := range interrupted {
+		err = RecordPayoutAttempt(PayoutAttempt{
+			Payout: payout.ID,
+			Date:   now,
+			Error:  "LightningTip stopped while the payout was sent",
+		}, PayoutFailed, now)
+
+		if err != nil {
+			return nil, err
+		}
+
+	}
+
+	return interrupted, err
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func setUpDatabase(t *testing.T) (tearDown func()) {
+	dir, err := ioutil.TempDir("", "lightningtip-database")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = InitDatabase(path.Join(dir, "tips.db")); err != nil {
+		t.Fatal(err)
+	}
+
+	return func() {
+		db.Close()
+
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBatchPayoutShares(t *testing.T) {
+	defer setUpDatabase(t)()
+
+	err := AddPayoutShares(1, []PayoutShare{
+		{Destination: "alice@example.com", AmountMsat: 6000},
+		{Destination: "bob@example.com", AmountMsat: 2000},
+	})
+
+	if err == nil {
+		err = AddPayoutShares(2, []PayoutShare{{Destination: "alice@example.com", AmountMsat: 5000}})
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the shares for Alice add up to the minimal amount
+	batched, err := BatchPayoutShares(10000)
+
+	if err != nil || batched != 1 {
+		t.Fatalf("unexpected number of payouts %d: %v", batched, err)
+	}
+
+	payouts, err := GetDuePayouts(time.Now())
+
+	if err != nil || len(payouts) != 1 {
+		t.Fatalf("unexpected payouts %v: %v", payouts, err)
+	}
+
+	if payouts[0].Destination != "alice@example.com" || payouts[0].AmountMsat != 11000 || payouts[0].State != PayoutPending {
+		t.Errorf("unexpected payout %v", payouts[0])
+	}
+
+	// Shares that were batched already must not be paid out again
+	if batched, err = BatchPayoutShares(1000); err != nil || batched != 1 {
+		t.Fatalf("unexpected number of payouts %d: %v", batched, err)
+	}
+
+	if payouts, _ = GetDuePayouts(time.Now()); len(payouts) != 2 || payouts[1].AmountMsat != 2000 {
+		t.Errorf("unexpected payouts %v", payouts)
+	}
+
+	if batched, err = BatchPayoutShares(1000); err != nil || batched != 0 {
+		t.Errorf("shares were batched twice: %d %v", batched, err)
+	}
+
+}
+
+func TestFailInterruptedPayouts(t *testing.T) {
+	defer setUpDatabase(t)()
+
+	AddPayoutShares(1, []PayoutShare{
+		{Destination: "alice@example.com", AmountMsat: 1000},
+		{Destination: "bob@example.com", AmountMsat: 1000},
+	})
+
+	if _, err := BatchPayoutShares(1000); err != nil {
+		t.Fatal(err)
+	}
+
+	payouts, _ := GetDuePayouts(time.Now())
+
+	if len(payouts) != 2 {
+		t.Fatalf("unexpected payouts %v", payouts)
+	}
+
+	// Only the payout that was being sent was interrupted
+	if err := StartPayoutAttempt(payouts[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	interrupted, err := FailInterruptedPayouts()
+
+	if err != nil || len(interrupted) != 1 || interrupted[0].ID != payouts[0].ID {
+		t.Fatalf("unexpected interrupted payouts %v: %v", interrupted, err)
+	}
+
+	failed, err := GetPayout(payouts[0].ID)
+
+	if err != nil || failed.State != PayoutFailed || failed.Attempts != 1 {
+		t.Errorf("interrupted payout was not marked as failed %v: %v", failed, err)
+	}
+
+	if pending, _ := GetPayout(payouts[1].ID); pending.State != PayoutPending || pending.Attempts != 0 {
+		t.Errorf("payout that was not sent changed %v", pending)
+	}
+
+	if interrupted, _ = FailInterruptedPayouts(); len(interrupted) != 0 {
+		t.Errorf("payouts were interrupted twice %v", interrupted)
+	}
+
+}
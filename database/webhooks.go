@@ -0,0 +1,161 @@
+package database
+
+import (
+	"time"
+)
+
+// WebhookDelivery is an event that has to be posted to a webhook URL
+type WebhookDelivery struct {
+	ID          int64
+	URL         string
+	Event       string
+	Payload     []byte
+	State       string
+	Created     time.Time
+	Attempts    int64
+	NextAttempt time.Time
+}
+
+// WebhookAttempt is the result of posting an event. Status is 0 if there was no response and Error is empty
+// if the event was delivered successfully
+type WebhookAttempt struct {
+	Delivery int64
+	Date     time.Time
+	Status   int
+	Error    string
+}
+
+// States of webhook deliveries
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+func initWebhookTables() {
+	db.Exec("CREATE TABLE IF NOT EXISTS `webhook_deliveries` (`id` INTEGER PRIMARY KEY AUTOINCREMENT, `url` VARCHAR, " +
+		"`event` VARCHAR, `payload` VARCHAR, `state` VARCHAR, `created` INTEGER, `attempts` INTEGER DEFAULT 0, " +
+		"`next_attempt` INTEGER, `delivered_date` INTEGER DEFAULT 0)")
+
+	db.Exec("CREATE TABLE IF NOT EXISTS `webhook_attempts` (`delivery` INTEGER, `date` INTEGER, `status` INTEGER, `error` VARCHAR)")
+}
+
+// AddWebhookDeliveries queues an event for delivery to all URLs
+func AddWebhookDeliveries(urls []string, event string, payload []byte) error {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+
+	for _, url := range urls {
+		_, err = tx.Exec(
+			"INSERT INTO webhook_deliveries(url, event, payload, state, created, next_attempt) values(?, ?, ?, ?, ?, ?)",
+			url,
+			event,
+			string(payload),
+			WebhookPending,
+			now,
+			now,
+		)
+
+		if err != nil {
+			tx.Rollback()
+
+			return err
+		}
+
+	}
+
+	return tx.Commit()
+}
+
+// GetDueWebhookDeliveries gets the pending deliveries whose next attempt is due in the order they were queued
+func GetDueWebhookDeliveries(now time.Time) (deliveries []WebhookDelivery, err error) {
+	rows, err := db.Query(
+		"SELECT id, url, event, payload, state, created, attempts, next_attempt FROM webhook_deliveries "+
+			"WHERE state = ? AND next_attempt <= ? ORDER BY id",
+		WebhookPending,
+		now.Unix(),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload string
+		var created int64
+		var nextAttempt int64
+
+		err = rows.Scan(
+			&delivery.ID,
+			&delivery.URL,
+			&delivery.Event,
+			&payload,
+			&delivery.State,
+			&created,
+			&delivery.Attempts,
+			&nextAttempt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		delivery.Payload = []byte(payload)
+		delivery.Created = time.Unix(created, 0)
+		delivery.NextAttempt = time.Unix(nextAttempt, 0)
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RecordWebhookAttempt records the result of posting an event and sets the new state of the delivery
+// The next attempt is only relevant if the new state is pending
+func RecordWebhookAttempt(attempt WebhookAttempt, state string, nextAttempt time.Time) error {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO webhook_attempts(delivery, date, status, error) values(?, ?, ?, ?)",
+		attempt.Delivery,
+		attempt.Date.Unix(),
+		attempt.Status,
+		nullString(attempt.Error),
+	)
+
+	if err == nil {
+		var deliveredDate int64
+
+		if state == WebhookDelivered {
+			deliveredDate = attempt.Date.Unix()
+		}
+
+		_, err = tx.Exec(
+			"UPDATE webhook_deliveries SET state = ?, attempts = attempts + 1, next_attempt = ?, delivered_date = ? WHERE id = ?",
+			state,
+			nextAttempt.Unix(),
+			deliveredDate,
+			attempt.Delivery,
+		)
+	}
+
+	if err != nil {
+		tx.Rollback()
+
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/donovanhide/eventsource"
+	"github.com/michael1011/lightningtip/database"
+)
+
+// invoiceEvent is sent when the state of an invoice changes
+type invoiceEvent struct {
+	RHash string
+	State string
+}
+
+// To use the invoiceEvent type as event for the EventSource stream
+
+// Id gets the ID of the event which is not needed in our scenario
+func (event invoiceEvent) Id() string { return "" } // nolint: golint
+
+// Event is the new state of the invoice
+func (event invoiceEvent) Event() string { return event.State }
+
+// Data is the payment hash of the invoice
+func (event invoiceEvent) Data() string { return event.RHash }
+
+// Whether the invoice can't change its state anymore
+func (event invoiceEvent) final() bool {
+	return event.State != database.InvoicePending && event.State != database.InvoiceAccepted
+}
+
+// invoiceSubscriptions delivers invoice events to the subscribers of specific invoices
+type invoiceSubscriptions struct {
+	lock sync.Mutex
+
+	subscribers map[string]map[chan invoiceEvent]struct{}
+}
+
+var subscriptions = invoiceSubscriptions{
+	subscribers: make(map[string]map[chan invoiceEvent]struct{}),
+}
+
+func (subscriptions *invoiceSubscriptions) subscribe(rHash string, events chan invoiceEvent) {
+	subscriptions.lock.Lock()
+	defer subscriptions.lock.Unlock()
+
+	if _, ok := subscriptions.subscribers[rHash]; !ok {
+		subscriptions.subscribers[rHash] = make(map[chan invoiceEvent]struct{})
+	}
+
+	subscriptions.subscribers[rHash][events] = struct{}{}
+}
+
+func (subscriptions *invoiceSubscriptions) unsubscribe(rHash string, events chan invoiceEvent) {
+	subscriptions.lock.Lock()
+	defer subscriptions.lock.Unlock()
+
+	delete(subscriptions.subscribers[rHash], events)
+
+	if len(subscriptions.subscribers[rHash]) == 0 {
+		delete(subscriptions.subscribers, rHash)
+	}
+}
+
+// Subscribers that can't keep up miss events instead of blocking the publisher
+func (subscriptions *invoiceSubscriptions) publish(event invoiceEvent) {
+	subscriptions.lock.Lock()
+	defer subscriptions.lock.Unlock()
+
+	for events := range subscriptions.subscribers[event.RHash] {
+		select {
+		case events <- event:
+		default:
+			log.Warning("Dropped event of invoice because subscriber is too slow: " + event.RHash)
+		}
+	}
+
+}
+
+func publishInvoiceEvent(event invoiceEvent) {
+	subscriptions.publish(event)
+}
+
+// Streams the events of a single invoice and closes the stream when the invoice can't change its state anymore
+func invoiceEventsHandler(writer http.ResponseWriter, request *http.Request) {
+	rHash := strings.TrimPrefix(request.URL.Path, "/eventsource/")
+
+	if request.Method != http.MethodGet || rHash == "" {
+		log.Error(couldNotParseError)
+
+		writeError(writer, couldNotParseError)
+
+		return
+	}
+
+	flusher, ok := writer.(http.Flusher)
+
+	if !ok {
+		writeError(writer, "Streaming is not supported")
+
+		return
+	}
+
+	// Subscribing before checking the current state makes sure no event is missed
+	events := make(chan invoiceEvent, 4)
+
+	subscriptions.subscribe(rHash, events)
+	defer subscriptions.unsubscribe(rHash, events)
+
+	event := invoiceEvent{
+		RHash: rHash,
+		State: getInvoiceState(rHash, false).State,
+	}
+
+	// Browsers reconnect to streams that are closed right away but give up after responses with an error status
+	if event.State == invoiceUnknown {
+		writer.WriteHeader(http.StatusNotFound)
+
+		writer.Write(marshalJSON(errorResponse{
+			Error: "Unknown invoice",
+		}))
+
+		return
+	}
+
+	header := writer.Header()
+	header.Set("Content-Type", "text/event-stream; charset=utf-8")
+	header.Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	header.Set("Connection", "keep-alive")
+
+	writer.WriteHeader(http.StatusOK)
+
+	encoder := eventsource.NewEncoder(writer, false)
+
+	for {
+		if err := encoder.Encode(event); err != nil {
+			return
+		}
+
+		flusher.Flush()
+
+		if event.final() {
+			return
+		}
+
+		select {
+		case event = <-events:
+		case <-request.Context().Done():
+			return
+		}
+
+	}
+
+}
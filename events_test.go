@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/donovanhide/eventsource"
+	"github.com/michael1011/lightningtip/backends"
+	"github.com/michael1011/lightningtip/database"
+)
+
+// Creates an invoice that is pending until the given expiry
+func addTestInvoice(t *testing.T, expiry time.Time) PendingInvoice {
+	invoice, rHash, _, err := createInvoice(getInvoiceOptions("thanks", 1000))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending := PendingInvoice{
+		Invoice:    invoice,
+		RHash:      rHash,
+		AmountMsat: 1000,
+		Message:    "thanks",
+		Expiry:     expiry,
+	}
+
+	addPendingInvoice(pending)
+
+	return pending
+}
+
+// Subscribes to the events of an invoice and returns the decoder of the stream
+func subscribeInvoiceEvents(t *testing.T, server *httptest.Server, rHash string) (*eventsource.Decoder, func()) {
+	response, err := http.Get(server.URL + "/eventsource/" + rHash)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status of stream %s", response.Status)
+	}
+
+	return eventsource.NewDecoder(response.Body), func() { response.Body.Close() }
+}
+
+// Checks that the next events of the stream have the given states and that the stream ends afterwards
+func assertInvoiceEvents(t *testing.T, decoder *eventsource.Decoder, rHash string, states ...string) {
+	for _, state := range states {
+		event, err := decoder.Decode()
+
+		if err != nil {
+			t.Fatalf("stream ended before %s event: %v", state, err)
+		}
+
+		if event.Event() != state || event.Data() != rHash {
+			t.Errorf("unexpected event %s with data %s instead of %s", event.Event(), event.Data(), state)
+		}
+
+	}
+
+	if event, err := decoder.Decode(); err != io.EOF {
+		t.Errorf("stream did not end after final event %v: %v", event, err)
+	}
+
+}
+
+func TestInvoiceEvents(t *testing.T) {
+	_, tearDown := setUpMockBackend(t)
+	defer tearDown()
+
+	server := httptest.NewServer(http.HandlerFunc(invoiceEventsHandler))
+	defer server.Close()
+
+	// Settled invoices
+	settled := addTestInvoice(t, time.Now().Add(time.Hour))
+
+	decoder, closeStream := subscribeInvoiceEvents(t, server, settled.RHash)
+	defer closeStream()
+
+	if event, err := decoder.Decode(); err != nil || event.Event() != database.InvoicePending {
+		t.Fatalf("unexpected first event %v: %v", event, err)
+	}
+
+	publishInvoiceSettled(backends.SettledInvoice{
+		Invoice: settled.Invoice,
+		RHash:   settled.RHash,
+	})
+
+	assertInvoiceEvents(t, decoder, settled.RHash, database.InvoiceSettled)
+
+	// Clients that subscribe after the invoice was settled get its final state right away
+	decoder, closeSettled := subscribeInvoiceEvents(t, server, settled.RHash)
+	defer closeSettled()
+
+	assertInvoiceEvents(t, decoder, settled.RHash, database.InvoiceSettled)
+
+	// Expired invoices
+	expired := addTestInvoice(t, time.Now().Add(time.Hour))
+
+	decoder, closeExpired := subscribeInvoiceEvents(t, server, expired.RHash)
+	defer closeExpired()
+
+	if event, err := decoder.Decode(); err != nil || event.Event() != database.InvoicePending {
+		t.Fatalf("unexpected first event %v: %v", event, err)
+	}
+
+	expireDueInvoices(time.Now().Add(2 * time.Hour))
+
+	assertInvoiceEvents(t, decoder, expired.RHash, database.InvoiceExpired)
+
+	// Streams of unknown invoices are not opened at all to stop browsers from reconnecting
+	response, err := http.Get(server.URL + "/eventsource/00")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("stream of unknown invoice was answered with %s", response.Status)
+	}
+
+}
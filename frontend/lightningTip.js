@@ -7,6 +7,12 @@ if (window.location.protocol === "file:") {
     requestUrl = "http://localhost:8081/"
 }
 
+// Set this variable to the ID of a goal configured in LightningTip to attribute the tips to it
+var goal = "";
+
+// Set this variable to the name of a jar configured in LightningTip to send the tips to it
+var jar = "";
+
 // To prohibit multiple requests at the same time
 var requestPending = false;
 
@@ -45,8 +51,50 @@ window.onload = function () {
 
     button.style.height = (button.clientHeight + 1) + "px";
     button.style.width = (button.clientWidth + 1) + "px";
+
+    loadConfig();
 };
 
+// Gets the limits and presets of the tip amount from LightningTip
+function loadConfig() {
+    var request = new XMLHttpRequest();
+
+    request.onreadystatechange = function () {
+        if (request.readyState === 4 && request.status === 200) {
+            var config = JSON.parse(request.responseText);
+
+            var amount = document.getElementById("lightningTipAmount");
+
+            amount.min = config.MinTip;
+
+            if (config.MaxTip > 0) {
+                amount.max = config.MaxTip;
+            }
+
+            if (config.TipPresets.length > 0) {
+                var presets = document.createElement("datalist");
+
+                presets.id = "lightningTipPresets";
+
+                for (var i = 0; i < config.TipPresets.length; i++) {
+                    var option = document.createElement("option");
+
+                    option.value = config.TipPresets[i];
+                    presets.appendChild(option);
+                }
+
+                amount.parentElement.appendChild(presets);
+                amount.setAttribute("list", presets.id);
+            }
+
+        }
+
+    };
+
+    request.open("GET", requestUrl + "config", true);
+    request.send();
+}
+
 // TODO: show invoice even if JavaScript is disabled
 // TODO: fix scaling on phones
 // TODO: show price in dollar?
@@ -58,7 +106,13 @@ function getInvoice() {
 
         if (tipValue.value !== "") {
             if (!isNaN(tipValue.value)) {
-                var data = JSON.stringify({"Amount": parseInt(tipValue.value), "Message": document.getElementById("lightningTipMessage").innerText});
+                var data = JSON.stringify({
+                    "Amount": parseInt(tipValue.value),
+                    "Message": document.getElementById("lightningTipMessage").innerText,
+                    "Nickname": document.getElementById("lightningTipNickname").value,
+                    "Goal": goal,
+                    "Jar": jar
+                });
 
                 var request = new XMLHttpRequest();
 
@@ -142,18 +196,37 @@ function getInvoice() {
 
 function listenInvoiceSettled(rHash) {
     try {
-        var eventSrc = new EventSource(requestUrl + "eventsource");
+        // This stream contains only the events of the invoice with the given rHash
+        var eventSrc = new EventSource(requestUrl + "eventsource/" + rHash);
 
-        eventSrc.onmessage = function (event) {
-            if (event.data === rHash) {
-                console.log("Invoice settled");
+        eventSrc.addEventListener("settled", function () {
+            console.log("Invoice settled");
 
-                eventSrc.close();
+            eventSrc.close();
 
-                showThankYouScreen();
-            }
+            showThankYouScreen();
+        });
+
+        eventSrc.addEventListener("expired", function () {
+            console.log("Invoice expired");
+
+            eventSrc.close();
+        });
 
-        };
+        // Tips paid with hold invoices have to be approved before they are settled
+        eventSrc.addEventListener("accepted", function () {
+            console.log("Invoice accepted");
+
+            showFinishedScreen("Your tip is waiting for approval");
+        });
+
+        eventSrc.addEventListener("canceled", function () {
+            console.log("Invoice canceled");
+
+            eventSrc.close();
+
+            showFinishedScreen("Your tip was declined and refunded");
+        });
 
     } catch (e) {
         console.error(e);
@@ -196,10 +269,14 @@ function listenInvoiceSettled(rHash) {
 }
 
 function showThankYouScreen() {
+    showFinishedScreen("Thank you for your tip!");
+}
+
+function showFinishedScreen(message) {
     var wrapper = document.getElementById("lightningTip");
 
     wrapper.innerHTML = "<p id=\"lightningTipLogo\">⚡</p>";
-    wrapper.innerHTML += "<a id='lightningTipFinished'>Thank you for your tip!</a>";
+    wrapper.innerHTML += "<a id='lightningTipFinished'>" + message + "</a>";
 }
 
 function starTimer(duration, element) {
@@ -212,7 +289,10 @@ function starTimer(duration, element) {
             showTimer(duration, element);
 
         } else {
-            showExpired();
+            // The timer is not shown anymore if the invoice was paid already
+            if (document.body.contains(element)) {
+                showExpired();
+            }
 
             clearInterval(interval);
         }
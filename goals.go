@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michael1011/lightningtip/database"
+)
+
+const goalsPath = "/goals/"
+
+// Format of the start and end dates of goals in the config
+const goalDateFormat = "2006-01-02"
+
+// The goals from the config by their ID
+var goals = make(map[string]database.Goal)
+
+type goalResponse struct {
+	ID         string
+	Label      string
+	Target     int64
+	TargetMsat int64
+	Raised     int64
+	RaisedMsat int64
+	Tips       int64
+	Start      int64
+	End        int64
+	Active     bool
+}
+
+// goalEvent is sent to the EventSource stream when a tip was attributed to a goal
+type goalEvent goalResponse
+
+// To use the goalEvent type as event for the EventSource stream
+
+// Id gets the ID of the event which is not needed in our scenario
+func (event goalEvent) Id() string { return "" } // nolint: golint
+
+// Event is for telling the progress of goals apart from the payment hashes of settled invoices
+func (event goalEvent) Event() string { return "goal" }
+
+// Data is the progress of the goal encoded as JSON
+func (event goalEvent) Data() string {
+	data, _ := json.Marshal(event)
+
+	return string(data)
+}
+
+// Parses a goal in the format "id:target:start:end:label". The target is in satoshis and the dates are in the
+// format YYYY-MM-DD and can be empty. The goal ends at the end of the day of the end date
+func parseGoal(value string) (goal database.Goal, err error) {
+	parts := strings.SplitN(value, ":", 5)
+
+	if len(parts) != 5 {
+		return goal, errors.New("expected the format id:target:start:end:label")
+	}
+
+	goal.ID = strings.TrimSpace(parts[0])
+	goal.Label = strings.TrimSpace(parts[4])
+
+	if goal.ID == "" || strings.Contains(goal.ID, "/") {
+		return goal, errors.New("invalid ID")
+	}
+
+	target, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+
+	if err != nil || target < 1 {
+		return goal, errors.New("target must be a positive number of satoshis")
+	}
+
+	goal.TargetMsat = target * 1000
+
+	if start := strings.TrimSpace(parts[2]); start != "" {
+		goal.Start, err = time.ParseInLocation(goalDateFormat, start, time.Local)
+
+		if err != nil {
+			return goal, errors.New("invalid start date")
+		}
+
+	}
+
+	if end := strings.TrimSpace(parts[3]); end != "" {
+		goal.End, err = time.ParseInLocation(goalDateFormat, end, time.Local)
+
+		if err != nil {
+			return goal, errors.New("invalid end date")
+		}
+
+		goal.End = goal.End.AddDate(0, 0, 1)
+	}
+
+	if goal.Label == "" {
+		goal.Label = goal.ID
+	}
+
+	return goal, nil
+}
+
+// Persists the goals from the config so that tipreport can show them
+func saveGoals() {
+	for _, goal := range goals {
+		if err := database.SaveGoal(goal); err != nil {
+			log.Error("Failed to save goal " + goal.ID + " in database: " + fmt.Sprint(err))
+		}
+
+	}
+
+}
+
+func goalActive(goal database.Goal, now time.Time) bool {
+	return (goal.Start.IsZero() || !now.Before(goal.Start)) && (goal.End.IsZero() || now.Before(goal.End))
+}
+
+// Returns an error message if tips can't be attributed to the goal
+func validateGoal(id string) string {
+	goal, ok := goals[id]
+
+	if !ok {
+		return "Unknown goal"
+	}
+
+	if !goalActive(goal, time.Now()) {
+		return "Goal is not active"
+	}
+
+	return ""
+}
+
+// Shows how much was raised for the goal with the ID after the path
+func goalHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeError(writer, couldNotParseError)
+
+		return
+	}
+
+	goal, ok := goals[strings.TrimPrefix(request.URL.Path, goalsPath)]
+
+	if !ok {
+		writeError(writer, "Unknown goal")
+
+		return
+	}
+
+	response, err := getGoalProgress(goal)
+
+	if err != nil {
+		log.Error("Failed to get progress of goal " + goal.ID + ": " + fmt.Sprint(err))
+
+		writeError(writer, "Failed to get progress of goal")
+
+		return
+	}
+
+	writer.Write(marshalJSON(response))
+}
+
+func getGoalProgress(goal database.Goal) (response goalResponse, err error) {
+	raisedMsat, tips, err := database.GetGoalProgress(goal)
+
+	if err != nil {
+		return response, err
+	}
+
+	response = goalResponse{
+		ID:         goal.ID,
+		Label:      goal.Label,
+		Target:     goal.TargetMsat / 1000,
+		TargetMsat: goal.TargetMsat,
+		Raised:     raisedMsat / 1000,
+		RaisedMsat: raisedMsat,
+		Tips:       tips,
+		Active:     goalActive(goal, time.Now()),
+	}
+
+	if !goal.Start.IsZero() {
+		response.Start = goal.Start.Unix()
+	}
+
+	if !goal.End.IsZero() {
+		response.End = goal.End.Unix()
+	}
+
+	return response, err
+}
+
+// Pushes the new progress of a goal to the EventSource stream after a tip was attributed to it
+func publishGoalProgress(id string) {
+	goal, ok := goals[id]
+
+	if !ok {
+		return
+	}
+
+	response, err := getGoalProgress(goal)
+
+	if err != nil {
+		log.Error("Failed to get progress of goal " + goal.ID + ": " + fmt.Sprint(err))
+
+		return
+	}
+
+	eventSrv.Publish([]string{eventChannel}, goalEvent(response))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/michael1011/lightningtip/backends"
+	"github.com/michael1011/lightningtip/database"
+)
+
+func TestParseGoal(t *testing.T) {
+	goal, err := parseGoal("spring: 21000 :2026-03-01:2026-03-31:Spring: new server")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The goal ends at the end of its last day
+	if goal.ID != "spring" || goal.TargetMsat != 21000000 || goal.Label != "Spring: new server" ||
+		!goal.Start.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)) || !goal.End.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.Local)) {
+
+		t.Errorf("unexpected goal %v", goal)
+	}
+
+	if goal, err = parseGoal("open:1000:::"); err != nil || goal.Label != "open" || !goal.Start.IsZero() || !goal.End.IsZero() {
+		t.Errorf("unexpected goal without dates %v: %v", goal, err)
+	}
+
+	for _, value := range []string{
+		"spring:21000:2026-03-01:2026-03-31",
+		":21000:::",
+		"a/b:21000:::",
+		"spring:0:::",
+		"spring:a lot:::",
+		"spring:21000:March::",
+		"spring:21000::2026-13-01:",
+	} {
+		if _, err = parseGoal(value); err == nil {
+			t.Errorf("invalid goal %s was accepted", value)
+		}
+
+	}
+
+}
+
+func TestGoalHandler(t *testing.T) {
+	_, tearDown := setUpMockBackend(t)
+	defer tearDown()
+
+	previousGoals := goals
+	defer func() { goals = previousGoals }()
+
+	now := time.Now()
+
+	goals = map[string]database.Goal{
+		"current": {ID: "current", Label: "Current", TargetMsat: 10000, Start: now.Add(-time.Hour)},
+		"past":    {ID: "past", Label: "Past", TargetMsat: 10000, End: now.Add(-time.Hour)},
+	}
+
+	// Tips attributed to a goal after it ended don't count towards it
+	for _, goal := range []string{"current", "current", "past"} {
+		invoice, rHash, _, err := createInvoice(getInvoiceOptions("thanks", 1000))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addPendingInvoice(PendingInvoice{
+			Invoice:    invoice,
+			RHash:      rHash,
+			AmountMsat: 1000,
+			Goal:       goal,
+			Expiry:     now.Add(time.Hour),
+		})
+
+		publishInvoiceSettled(backends.SettledInvoice{
+			Invoice: invoice,
+			RHash:   rHash,
+		})
+	}
+
+	progress := map[string]goalResponse{
+		"current": {ID: "current", Label: "Current", Target: 10, TargetMsat: 10000, Raised: 2, RaisedMsat: 2000, Tips: 2,
+			Start: now.Add(-time.Hour).Unix(), Active: true},
+		"past": {ID: "past", Label: "Past", Target: 10, TargetMsat: 10000, End: now.Add(-time.Hour).Unix()},
+	}
+
+	for id, expected := range progress {
+		var response goalResponse
+
+		recorder := httptest.NewRecorder()
+
+		goalHandler(recorder, httptest.NewRequest(http.MethodGet, goalsPath+id, nil))
+
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response != expected {
+			t.Errorf("unexpected progress of goal %s: %s", id, recorder.Body.String())
+		}
+
+	}
+
+	var response errorResponse
+
+	recorder := httptest.NewRecorder()
+
+	goalHandler(recorder, httptest.NewRequest(http.MethodGet, goalsPath+"unknown", nil))
+
+	if json.Unmarshal(recorder.Body.Bytes(), &response); recorder.Code != http.StatusBadRequest || response.Error != "Unknown goal" {
+		t.Errorf("unknown goal was answered with %d %s", recorder.Code, recorder.Body.String())
+	}
+
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/michael1011/lightningtip/backends"
+	"github.com/michael1011/lightningtip/database"
+)
+
+// Modes for hold invoices. In the manual mode every tip has to be settled or canceled via the admin interface
+// and in the filter mode tips are settled automatically unless their message contains a word of "holdfilter"
+const (
+	holdModeOff    = "off"
+	holdModeManual = "manual"
+	holdModeFilter = "filter"
+)
+
+// How often pending hold invoices are checked for whether they were paid
+const holdInvoiceCheckInterval = 5 * time.Second
+
+// heldInvoice is a hold invoice that was paid but neither settled nor canceled yet
+type heldInvoice struct {
+	PendingInvoice
+
+	AcceptDate time.Time
+}
+
+// heldInvoiceStore keeps track of the held invoices by their payment hash and is safe for concurrent use
+type heldInvoiceStore struct {
+	lock sync.Mutex
+
+	invoices map[string]heldInvoice
+}
+
+var heldInvoices = heldInvoiceStore{
+	invoices: make(map[string]heldInvoice),
+}
+
+func (store *heldInvoiceStore) add(invoice heldInvoice) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.invoices[invoice.RHash] = invoice
+}
+
+// Only one of multiple concurrent callers gets the invoice which makes sure it is settled or canceled only once
+func (store *heldInvoiceStore) remove(rHash string) (heldInvoice, bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	invoice, ok := store.invoices[rHash]
+
+	if ok {
+		delete(store.invoices, rHash)
+	}
+
+	return invoice, ok
+}
+
+// Returns a copy of all held invoices ordered by the time they were accepted
+func (store *heldInvoiceStore) all() []heldInvoice {
+	store.lock.Lock()
+
+	invoices := make([]heldInvoice, 0, len(store.invoices))
+
+	for _, invoice := range store.invoices {
+		invoices = append(invoices, invoice)
+	}
+
+	store.lock.Unlock()
+
+	sort.Slice(invoices, func(i, j int) bool {
+		return invoices[i].AcceptDate.Before(invoices[j].AcceptDate)
+	})
+
+	return invoices
+}
+
+// The preimage is generated by LightningTip and only revealed to the backend when the invoice is settled
+func addHoldInvoice(options backends.InvoiceOptions) (invoice string, rHash string, preimage string, err error) {
+	preimageBytes := make([]byte, 32)
+
+	_, err = rand.Read(preimageBytes)
+
+	if err != nil {
+		return "", "", "", err
+	}
+
+	paymentHash := sha256.Sum256(preimageBytes)
+
+	invoice, err = backend.AddHoldInvoice(options, paymentHash[:])
+
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return invoice, hex.EncodeToString(paymentHash[:]), hex.EncodeToString(preimageBytes), err
+}
+
+// Hold invoices that were accepted before a restart still have to be settled or canceled
+func loadAcceptedInvoices() {
+	invoices, err := database.GetAcceptedInvoices()
+
+	if err != nil {
+		log.Error("Failed to load accepted hold invoices from database: " + fmt.Sprint(err))
+
+		return
+	}
+
+	for _, invoice := range invoices {
+		heldInvoices.add(heldInvoice{
+			PendingInvoice: PendingInvoice(invoice.PendingInvoice),
+			AcceptDate:     invoice.AcceptDate,
+		})
+	}
+
+}
+
+// Checks periodically whether pending hold invoices were paid and cancels the held ones that timed out
+func checkHoldInvoices() {
+	ticker := time.NewTicker(holdInvoiceCheckInterval)
+
+	for range ticker.C {
+		acceptPaidHoldInvoices()
+
+		if cfg.HoldTimeout > 0 {
+			cancelTimedOutHoldInvoices(time.Duration(cfg.HoldTimeout) * time.Second)
+		}
+
+	}
+
+}
+
+func acceptPaidHoldInvoices() {
+	for _, invoice := range pendingInvoices.All() {
+		if invoice.Preimage == "" {
+			continue
+		}
+
+		accepted, err := backend.HoldInvoiceAccepted(invoice.RHash)
+
+		if err != nil {
+			log.Warning("Failed to check if hold invoice was accepted: " + fmt.Sprint(err))
+
+			continue
+		}
+
+		if accepted {
+			acceptHoldInvoice(invoice)
+		}
+
+	}
+
+}
+
+func cancelTimedOutHoldInvoices(timeout time.Duration) {
+	for _, invoice := range heldInvoices.all() {
+		if time.Since(invoice.AcceptDate) > timeout {
+			log.Info("Hold invoice timed out: " + invoice.Invoice)
+
+			if err := cancelHoldInvoice(invoice.RHash); err != nil {
+				log.Warning("Failed to cancel hold invoice that timed out: " + fmt.Sprint(err))
+			}
+
+		}
+
+	}
+
+}
+
+func acceptHoldInvoice(invoice PendingInvoice) {
+	if _, ok := pendingInvoices.Remove(invoice.Invoice); !ok {
+		return
+	}
+
+	log.Info("Hold invoice accepted: " + invoice.Invoice)
+
+	database.AcceptHoldInvoice(invoice.Invoice)
+
+	heldInvoices.add(heldInvoice{
+		PendingInvoice: invoice,
+		AcceptDate:     time.Now(),
+	})
+
+	publishInvoiceEvent(invoiceEvent{
+		RHash: invoice.RHash,
+		State: database.InvoiceAccepted,
+	})
+
+	if cfg.HoldInvoices == holdModeFilter {
+		var err error
+
+		if word := matchHoldFilter(invoice.Message); word != "" {
+			log.Info("Declining tip because its message contains \"" + word + "\"")
+
+			err = cancelHoldInvoice(invoice.RHash)
+
+		} else {
+			err = settleHoldInvoice(invoice.RHash)
+		}
+
+		if err != nil {
+			log.Error("Failed to apply filter to hold invoice: " + fmt.Sprint(err))
+		}
+
+	}
+
+}
+
+// Returns the first word of "holdfilter" the message contains or an empty string if there is none
+func matchHoldFilter(message string) string {
+	message = strings.ToLower(message)
+
+	for _, word := range cfg.HoldFilter {
+		if word != "" && strings.Contains(message, strings.ToLower(word)) {
+			return word
+		}
+	}
+
+	return ""
+}
+
+func settleHoldInvoice(rHash string) error {
+	invoice, ok := heldInvoices.remove(rHash)
+
+	if !ok {
+		return errors.New("could not find accepted hold invoice")
+	}
+
+	preimage, err := hex.DecodeString(invoice.Preimage)
+
+	if err == nil {
+		err = backend.SettleHoldInvoice(preimage)
+	}
+
+	if err != nil {
+		heldInvoices.add(invoice)
+
+		return err
+	}
+
+	log.Info("Hold invoice settled: " + invoice.Invoice)
+
+	recordSettledInvoice(invoice.PendingInvoice)
+
+	return err
+}
+
+// The payer gets refunded when a hold invoice is canceled
+func cancelHoldInvoice(rHash string) error {
+	invoice, ok := heldInvoices.remove(rHash)
+
+	if !ok {
+		return errors.New("could not find accepted hold invoice")
+	}
+
+	err := backend.CancelHoldInvoice(rHash)
+
+	if err != nil {
+		heldInvoices.add(invoice)
+
+		return err
+	}
+
+	log.Info("Hold invoice canceled: " + invoice.Invoice)
+
+	database.CancelHoldInvoice(invoice.Invoice)
+
+	publishInvoiceEvent(invoiceEvent{
+		RHash: rHash,
+		State: database.InvoiceCanceled,
+	})
+
+	queueWebhook(newWebhookPayload(webhookInvoiceCanceled, invoice.PendingInvoice))
+
+	return err
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/michael1011/lightningtip/backends"
+	"github.com/michael1011/lightningtip/database"
+)
+
+// Uses the mock backend and a temporary database for the hold invoices in the given mode
+func setUpHoldInvoices(t *testing.T, mode string) (mock *backends.Mock, tearDown func()) {
+	mock, tearDown = setUpMockBackend(t)
+
+	cfg.HoldInvoices = mode
+	cfg.HoldFilter = []string{"spam"}
+
+	return mock, tearDown
+}
+
+// Creates a hold invoice for a tip and pays it
+func payHoldInvoice(t *testing.T, mock *backends.Mock, message string) PendingInvoice {
+	options := getInvoiceOptions(message, 1000)
+
+	invoice, rHash, preimage, err := createInvoice(options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending := PendingInvoice{
+		Invoice:    invoice,
+		RHash:      rHash,
+		AmountMsat: options.AmountMsat,
+		Message:    message,
+		Expiry:     time.Now().Add(time.Hour),
+		Preimage:   preimage,
+	}
+
+	addPendingInvoice(pending)
+
+	if err = mock.Pay(rHash); err != nil {
+		t.Fatal(err)
+	}
+
+	acceptPaidHoldInvoices()
+
+	return pending
+}
+
+func assertInvoiceState(t *testing.T, rHash string, expected string) {
+	invoice, err := database.GetInvoice(rHash)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if invoice.State != expected {
+		t.Errorf("invoice is %s instead of %s", invoice.State, expected)
+	}
+
+}
+
+func assertTips(t *testing.T, expected int) {
+	tips, err := database.GetTips(database.TipFilter{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tips) != expected {
+		t.Errorf("%d tips were recorded instead of %d", len(tips), expected)
+	}
+
+}
+
+func TestHoldInvoiceSettle(t *testing.T) {
+	mock, tearDown := setUpHoldInvoices(t, holdModeManual)
+	defer tearDown()
+
+	invoice := payHoldInvoice(t, mock, "thanks")
+
+	assertInvoiceState(t, invoice.RHash, database.InvoiceAccepted)
+	assertTips(t, 0)
+
+	if _, ok := pendingInvoices.GetByRHash(invoice.RHash); ok {
+		t.Error("accepted invoice is still pending")
+	}
+
+	if err := settleHoldInvoice(invoice.RHash); err != nil {
+		t.Fatal(err)
+	}
+
+	assertInvoiceState(t, invoice.RHash, database.InvoiceSettled)
+	assertTips(t, 1)
+
+	if settled, _ := mock.InvoiceSettled(invoice.RHash); !settled {
+		t.Error("hold invoice was not settled by the backend")
+	}
+
+	// Settling or canceling it again must not do anything
+	if err := settleHoldInvoice(invoice.RHash); err == nil {
+		t.Error("hold invoice was settled twice")
+	}
+
+	if err := cancelHoldInvoice(invoice.RHash); err == nil {
+		t.Error("settled hold invoice was canceled")
+	}
+
+	assertTips(t, 1)
+}
+
+func TestHoldInvoiceCancel(t *testing.T) {
+	mock, tearDown := setUpHoldInvoices(t, holdModeManual)
+	defer tearDown()
+
+	invoice := payHoldInvoice(t, mock, "thanks")
+
+	if err := cancelHoldInvoice(invoice.RHash); err != nil {
+		t.Fatal(err)
+	}
+
+	assertInvoiceState(t, invoice.RHash, database.InvoiceCanceled)
+	assertTips(t, 0)
+
+	if accepted, _ := mock.HoldInvoiceAccepted(invoice.RHash); accepted {
+		t.Error("hold invoice was not canceled by the backend")
+	}
+
+}
+
+func TestHoldInvoiceTimeout(t *testing.T) {
+	mock, tearDown := setUpHoldInvoices(t, holdModeManual)
+	defer tearDown()
+
+	invoice := payHoldInvoice(t, mock, "thanks")
+
+	cancelTimedOutHoldInvoices(time.Hour)
+
+	assertInvoiceState(t, invoice.RHash, database.InvoiceAccepted)
+
+	// Pretend that the invoice was accepted long ago
+	held, _ := heldInvoices.remove(invoice.RHash)
+	held.AcceptDate = time.Now().Add(-2 * time.Hour)
+
+	heldInvoices.add(held)
+
+	cancelTimedOutHoldInvoices(time.Hour)
+
+	assertInvoiceState(t, invoice.RHash, database.InvoiceCanceled)
+	assertTips(t, 0)
+}
+
+func TestHoldInvoiceFilter(t *testing.T) {
+	mock, tearDown := setUpHoldInvoices(t, holdModeFilter)
+	defer tearDown()
+
+	approved := payHoldInvoice(t, mock, "thanks")
+	declined := payHoldInvoice(t, mock, "Buy SPAM")
+
+	assertInvoiceState(t, approved.RHash, database.InvoiceSettled)
+	assertInvoiceState(t, declined.RHash, database.InvoiceCanceled)
+	assertTips(t, 1)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/michael1011/lightningtip/notifications"
+)
+
+// tipJar is a named recipient of tips with its own totals and settings
+type tipJar struct {
+	Name string
+
+	// Nil if no notifications should be sent for tips of the jar
+	Mail *notifications.Mail
+
+	// Messages are disabled if it is 0 and not limited if it is -1
+	MaxMessageLength int64
+}
+
+// The jars from the config by their name
+var jars = make(map[string]tipJar)
+
+// Parses a jar in the format "name:recipient:maxmessagelength". The notifications are sent to the recipient with
+// the other settings of the "Mail" group. An empty maximal message length means that messages are not limited
+func parseJar(value string) (jar tipJar, err error) {
+	parts := strings.SplitN(value, ":", 3)
+
+	if len(parts) != 3 {
+		return jar, errors.New("expected the format name:recipient:maxmessagelength")
+	}
+
+	jar.Name = strings.TrimSpace(parts[0])
+
+	if jar.Name == "" {
+		return jar, errors.New("name must not be empty")
+	}
+
+	if recipient := strings.TrimSpace(parts[1]); recipient != "" {
+		mail := *cfg.Mail
+		mail.Recipient = recipient
+
+		jar.Mail = &mail
+	}
+
+	jar.MaxMessageLength = -1
+
+	if maxLength := strings.TrimSpace(parts[2]); maxLength != "" {
+		jar.MaxMessageLength, err = strconv.ParseInt(maxLength, 10, 64)
+
+		if err != nil || jar.MaxMessageLength < 0 {
+			return jar, errors.New("maximal message length must be a number that is not negative")
+		}
+
+	}
+
+	return jar, nil
+}
+
+// Parses a setting of the "Mail" group for one jar in the format "jar:setting:value" and overrides the one the jar
+// got from the group. The value can contain colons to allow servers with ports
+func parseJarMail(value string) error {
+	parts := strings.SplitN(value, ":", 3)
+
+	if len(parts) != 3 {
+		return errors.New("expected the format jar:setting:value")
+	}
+
+	jar, ok := jars[strings.TrimSpace(parts[0])]
+
+	if !ok {
+		return errors.New("unknown jar")
+	}
+
+	if jar.Mail == nil {
+		return errors.New("jar has no recipient")
+	}
+
+	setting := strings.TrimSpace(parts[1])
+	value = strings.TrimSpace(parts[2])
+
+	switch setting {
+	case "sender":
+		jar.Mail.Sender = value
+
+	case "server":
+		jar.Mail.SMTPServer = value
+
+	case "ssl":
+		ssl, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return errors.New("ssl must be true or false")
+		}
+
+		jar.Mail.SMTPSSL = ssl
+
+	case "user":
+		jar.Mail.SMTPUser = value
+
+	case "password":
+		jar.Mail.SMTPPassword = value
+
+	default:
+		return errors.New("unknown setting \"" + setting + "\"")
+	}
+
+	return nil
+}
+
+// Returns an error message if the tip can't be sent to the jar
+func validateJar(name string, message string) string {
+	jar, ok := jars[name]
+
+	if !ok {
+		return "Unknown jar"
+	}
+
+	if jar.MaxMessageLength == 0 && message != "" {
+		return "Messages are disabled for this jar"
+	}
+
+	if jar.MaxMessageLength > 0 && int64(len([]rune(message))) > jar.MaxMessageLength {
+		return "Message must not be longer than " + strconv.FormatInt(jar.MaxMessageLength, 10) + " characters"
+	}
+
+	return ""
+}
+
+// Tips for jars are sent to the recipient of the jar and all others to the one of the "Mail" group
+func sendTipMail(jarName string, amountMsat int64, message string) {
+	mail := cfg.Mail
+
+	if jarName != "" {
+		mail = jars[jarName].Mail
+	}
+
+	if mail != nil && mail.Recipient != "" {
+		go mail.SendMail(amountMsat, message)
+	}
+
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/michael1011/lightningtip/notifications"
+)
+
+func TestParseJarMail(t *testing.T) {
+	previousCfg := cfg
+	previousJars := jars
+
+	defer func() {
+		cfg = previousCfg
+		jars = previousJars
+	}()
+
+	cfg.Mail = &notifications.Mail{
+		Sender:     "tips@example.com",
+		SMTPServer: "smtp.example.com:465",
+	}
+
+	jars = make(map[string]tipJar)
+
+	for _, value := range []string{"alice:alice@example.com:", "bob:bob@example.com:", "carol::"} {
+		jar, err := parseJar(value)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		jars[jar.Name] = jar
+	}
+
+	for _, value := range []string{"alice:server:mail.alice.example:587", "alice:ssl:true", "alice:user:alice"} {
+		if err := parseJarMail(value); err != nil {
+			t.Errorf("unexpected error for %s: %v", value, err)
+		}
+
+	}
+
+	for _, value := range []string{"dave:user:dave", "carol:user:carol", "alice:recipient:eve@example.com", "alice:ssl:maybe", "alice"} {
+		if err := parseJarMail(value); err == nil {
+			t.Errorf("invalid setting %s was accepted", value)
+		}
+
+	}
+
+	alice := jars["alice"].Mail
+
+	if alice.SMTPServer != "mail.alice.example:587" || !alice.SMTPSSL || alice.SMTPUser != "alice" || alice.Sender != "tips@example.com" {
+		t.Errorf("unexpected mail settings of jar %v", alice)
+	}
+
+	// The settings of other jars and the "Mail" group must not change
+	if bob := jars["bob"].Mail; bob.SMTPServer != "smtp.example.com:465" || bob.SMTPUser != "" {
+		t.Errorf("mail settings of other jar changed %v", bob)
+	}
+
+	if cfg.Mail.SMTPServer != "smtp.example.com:465" || cfg.Mail.SMTPSSL {
+		t.Errorf("mail settings of the group changed %v", cfg.Mail)
+	}
+
+}
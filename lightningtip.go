@@ -1,9 +1,13 @@
 package main
 
 import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"os"
 	"strconv"
@@ -11,25 +15,36 @@ import (
 	"time"
 
 	"github.com/donovanhide/eventsource"
+	"github.com/michael1011/lightningtip/backends"
 	"github.com/michael1011/lightningtip/database"
+	"github.com/michael1011/lightningtip/rates"
 )
 
 // PendingInvoice is for keeping alist of unpaid invoices
-type PendingInvoice struct {
-	Invoice string
-	Amount  int64
-	Message string
-	RHash   string
-	Expiry  time.Time
-}
+// They are persisted in the database to survive restarts
+type PendingInvoice database.PendingInvoice
 
 const eventChannel = "invoiceSettled"
 
 const couldNotParseError = "Could not parse values from request"
 
+const tipAmountTooBig = "Tip amount is too big"
+
+// Tips can't be bigger than 21 million bitcoin in millisatoshis even if their size is not limited
+const maxTipAmountMsat = 21000000 * 100000000 * 1000
+
+// The maximal length of the description of an invoice in bytes
+const maxDescriptionLength = 639
+
+// The states of invoices that are not in the database are unknown
+const invoiceUnknown = "unknown"
+
+// How long invoices are rescanned after they expired in case their payment was missed
+const expiredRescanWindow = 24 * time.Hour
+
 var eventSrv *eventsource.Server
 
-var pendingInvoices []PendingInvoice
+var pendingInvoices = newInvoiceRegistry()
 
 // To use the pendingInvoice type as event for the EventSource stream
 
@@ -42,15 +57,32 @@ func (pending PendingInvoice) Event() string { return "" }
 // Data tells EventSource what data to write
 func (pending PendingInvoice) Data() string { return pending.RHash }
 
+// Either the amount in satoshis, millisatoshis or fiat with its currency has to be set
 type invoiceRequest struct {
-	Amount  int64
-	Message string
+	Amount     int64
+	AmountMsat int64
+	Fiat       float64
+	Currency   string
+	Message    string
+
+	// Shown with the tip on the tip wall
+	Nickname string
+
+	// ID of the goal the tip is attributed to
+	Goal string
+
+	// Name of the jar the tip is for. Tips without a jar are for the operator of LightningTip
+	Jar string
 }
 
+// The rate is the price of one bitcoin in the currency and only set if the tip was denominated in fiat
 type invoiceResponse struct {
-	Invoice string
-	RHash   string
-	Expiry  int64
+	Invoice    string
+	RHash      string
+	Expiry     int64
+	AmountMsat int64
+	Currency   string
+	Rate       float64
 }
 
 type invoiceSettledRequest struct {
@@ -61,6 +93,23 @@ type invoiceSettledResponse struct {
 	Settled bool
 }
 
+type invoiceStateResponse struct {
+	State      string
+	Amount     int64
+	AmountMsat int64
+	Fiat       float64
+	Currency   string
+	Rate       float64
+	Expiry     int64
+	SettleDate int64
+}
+
+type configResponse struct {
+	MinTip     int64
+	MaxTip     int64
+	TipPresets []int64
+}
+
 type errorResponse struct {
 	Error string
 }
@@ -83,6 +132,12 @@ func main() {
 		log.Debug("Opened SQLite database: " + cfg.DatabaseFile)
 	}
 
+	backends.UseSettleIndexStore(database.SettleIndexStore{})
+
+	saveGoals()
+
+	loadPendingInvoices()
+
 	err := backend.Connect()
 
 	if err == nil {
@@ -94,43 +149,64 @@ func main() {
 
 		http.Handle("/", handleHeaders(notFoundHandler))
 		http.Handle("/getinvoice", handleHeaders(getInvoiceHandler))
+		http.Handle("/config", handleHeaders(configHandler))
 		http.Handle("/eventsource", handleHeaders(eventSrv.Handler(eventChannel)))
+		http.Handle("/eventsource/", handleHeaders(invoiceEventsHandler))
+
+		// For clients that handle WebSockets better than EventSource
+		http.Handle("/ws", websocketServer)
+
+		http.Handle("/invoice/", handleHeaders(invoiceStateHandler))
+
+		if cfg.TipWall {
+			http.Handle("/tips/recent", handleHeaders(recentTipsHandler))
+		}
+
+		if len(goals) > 0 {
+			http.Handle(goalsPath, handleHeaders(goalHandler))
+		}
+
+		if len(cfg.LNURL.Names) > 0 {
+			log.Info("Serving Lightning Addresses: " + strings.Join(cfg.LNURL.Names, ", "))
+
+			http.Handle(lnurlPayPath, handleHeaders(lnurlPayHandler))
+			http.Handle(lnurlCallbackPath, handleHeaders(lnurlCallbackHandler))
+		}
 
 		// Alternative for browsers which don't support EventSource (Internet Explorer and Edge)
 		http.Handle("/invoicesettled", handleHeaders(invoiceSettledHandler))
 
-		log.Debug("Starting ticker to clear expired invoices")
+		log.Debug("Starting timer to clear expired invoices")
 
-		// A bit longer than the expiry time to make sure the invoice doesn't show as settled if it isn't (affects just invoiceSettledHandler)
-		expiryInterval := time.Duration(cfg.TipExpiry + 10)
-		expiryTicker := time.Tick(expiryInterval * time.Second)
+		go expireInvoices()
 
 		go func() {
-			for {
-				select {
-				case <-expiryTicker:
-					now := time.Now()
+			subscribeToInvoices()
+		}()
 
-					for index := len(pendingInvoices) - 1; index >= 0; index-- {
-						invoice := pendingInvoices[index]
+		if cfg.HoldInvoices != holdModeOff {
+			log.Info("Using hold invoices in " + cfg.HoldInvoices + " mode")
 
-						if now.Sub(invoice.Expiry) > 0 {
-							log.Debug("Invoice expired: " + invoice.Invoice)
+			loadAcceptedInvoices()
 
-							pendingInvoices = append(pendingInvoices[:index], pendingInvoices[index+1:]...)
-						}
+			go checkHoldInvoices()
+		}
 
-					}
+		if cfg.AdminToken != "" {
+			startAdminServer()
+		}
 
-				}
+		if len(splits) > 0 {
+			log.Info("Paying out shares of tips every " + strconv.FormatInt(cfg.Payouts.Interval, 10) + " seconds")
 
-			}
+			go runPayouts()
+		}
 
-		}()
+		if len(cfg.Webhook.URLs) > 0 {
+			log.Info("Sending events to " + strconv.Itoa(len(cfg.Webhook.URLs)) + " webhooks")
 
-		go func() {
-			subscribeToInvoices()
-		}()
+			go runWebhooks()
+		}
 
 		if cfg.KeepAliveInterval > 0 {
 			log.Debug("Starting ticker to send keepalive requests")
@@ -175,6 +251,54 @@ func main() {
 
 }
 
+// Clears the invoices in the registry as soon as they expire
+func expireInvoices() {
+	for {
+		expireDueInvoices(time.Now())
+
+		// Invoices that were added could expire before the one that was the next to expire so far
+		var timer *time.Timer
+		var expired <-chan time.Time
+
+		if next, ok := pendingInvoices.NextExpiry(); ok {
+			timer = time.NewTimer(time.Until(next))
+			expired = timer.C
+		}
+
+		select {
+		case <-expired:
+		case <-pendingInvoices.Added():
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+	}
+
+}
+
+func expireDueInvoices(now time.Time) {
+	for _, invoice := range pendingInvoices.RemoveExpired(now) {
+		log.Debug("Invoice expired: " + invoice.Invoice)
+
+		database.ExpirePendingInvoice(invoice.Invoice)
+
+		// In case it was paid right before it expired and that was not noticed yet
+		if invoice.Preimage != "" {
+			go backend.CancelHoldInvoice(invoice.RHash)
+		}
+
+		publishInvoiceEvent(invoiceEvent{
+			RHash: invoice.RHash,
+			State: database.InvoiceExpired,
+		})
+
+		queueWebhook(newWebhookPayload(webhookInvoiceExpired, invoice))
+	}
+
+}
+
 func subscribeToInvoices() {
 	log.Info("Subscribing to invoices")
 
@@ -197,9 +321,7 @@ func subscribeToInvoices() {
 func reconnectToBackend() {
 	time.Sleep(time.Duration(cfg.ReconnectInterval) * time.Second)
 
-	log.Info("Trying to reconnect to LND")
-
-	backend = cfg.LND
+	log.Info("Trying to reconnect to backend")
 
 	err := backend.Connect()
 
@@ -209,7 +331,7 @@ func reconnectToBackend() {
 		// The default macaroon file used by LightningTip "invoice.macaroon" allows only creating and checking status of invoices
 		// The keep alive request doesn't have to be successful as long as it can establish a connection to LND
 		if err == nil || fmt.Sprint(err) == "rpc error: code = Unknown desc = permission denied" {
-			log.Info("Reconnected to LND")
+			log.Info("Reconnected to backend")
 
 			subscribeToInvoices()
 		}
@@ -223,16 +345,53 @@ func reconnectToBackend() {
 	reconnectToBackend()
 }
 
+// Invoices that were created before a restart are rescanned as soon as the subscription to the backend is established
+// Even the ones that expired already because they could have been paid while LightningTip was offline
+func loadPendingInvoices() {
+	invoices, err := database.GetPendingInvoices()
+
+	if err != nil {
+		log.Error("Failed to load pending invoices from database: " + fmt.Sprint(err))
+
+		return
+	}
+
+	for _, invoice := range invoices {
+		pendingInvoices.Add(PendingInvoice(invoice))
+	}
+
+	if len(invoices) > 0 {
+		log.Info("Loaded " + strconv.Itoa(len(invoices)) + " pending invoices from database")
+	}
+
+}
+
 func rescanPendingInvoices() {
-	if len(pendingInvoices) > 0 {
+	invoices := pendingInvoices.All()
+
+	// Tips could have been paid right before their invoice expired while the backend was not connected
+	expired, err := database.GetExpiredInvoices(time.Now().Add(-expiredRescanWindow))
+
+	if err != nil {
+		log.Warning("Failed to load expired invoices from database: " + fmt.Sprint(err))
+	}
+
+	for _, invoice := range expired {
+		invoices = append(invoices, PendingInvoice(invoice))
+	}
+
+	if len(invoices) > 0 {
 		log.Debug("Rescanning pending invoices")
 
-		for _, invoice := range pendingInvoices {
+		for _, invoice := range invoices {
 			settled, err := backend.InvoiceSettled(invoice.RHash)
 
 			if err == nil {
 				if settled {
-					publishInvoiceSettled(invoice.Invoice)
+					publishInvoiceSettled(backends.SettledInvoice{
+						Invoice: invoice.Invoice,
+						RHash:   invoice.RHash,
+					})
 				}
 
 			} else {
@@ -245,26 +404,124 @@ func rescanPendingInvoices() {
 
 }
 
-func publishInvoiceSettled(invoice string) {
-	for index, settled := range pendingInvoices {
-		if settled.Invoice == invoice {
-			log.Info("Invoice settled: " + invoice)
+// Persists an invoice and adds it to the pending invoices to wait for it to be settled
+func addPendingInvoice(pending PendingInvoice) {
+	database.AddPendingInvoice(database.PendingInvoice(pending))
 
-			eventSrv.Publish([]string{eventChannel}, settled)
+	pendingInvoices.Add(pending)
 
-			database.AddSettledInvoice(settled.Amount, settled.Message)
+	queueWebhook(newWebhookPayload(webhookInvoiceCreated, pending))
+}
 
-			if cfg.Mail.Recipient != "" {
-				cfg.Mail.SendMail(settled.Amount, settled.Message)
-			}
+func publishInvoiceSettled(paid backends.SettledInvoice) {
+	if paid.Keysend {
+		publishKeysendTip(paid)
+
+		return
+	}
+
+	settled, ok := pendingInvoices.Remove(paid.Invoice)
+
+	if !ok {
+		// Invoices that expired before their payment was noticed are not in the registry anymore
+		settled, ok = getUnsettledInvoice(paid.RHash)
+
+		if !ok {
+			return
+		}
+
+	}
+
+	log.Info("Invoice settled: " + paid.Invoice)
+
+	recordSettledInvoice(settled)
+}
+
+// Looks up an invoice that is not in the registry but could still be settled in the database
+func getUnsettledInvoice(rHash string) (PendingInvoice, bool) {
+	if rHash == "" {
+		return PendingInvoice{}, false
+	}
 
-			pendingInvoices = append(pendingInvoices[:index], pendingInvoices[index+1:]...)
+	invoice, err := database.GetInvoice(rHash)
 
-			break
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Warning("Failed to look up settled invoice: " + fmt.Sprint(err))
 		}
 
+		return PendingInvoice{}, false
+	}
+
+	if invoice.State != database.InvoicePending && invoice.State != database.InvoiceExpired {
+		return PendingInvoice{}, false
 	}
 
+	return PendingInvoice(invoice.PendingInvoice), true
+}
+
+// Records a tip and notifies everyone who is interested in it. Nothing happens if the tip was recorded already
+func recordSettledInvoice(settled PendingInvoice) {
+	id, ok := database.SettlePendingInvoice(database.PendingInvoice(settled), cfg.TipWallApproval)
+
+	if !ok {
+		return
+	}
+
+	eventSrv.Publish([]string{eventChannel}, settled)
+
+	addPayoutShares(id, settled.Jar, settled.AmountMsat)
+
+	publishTip(id, settled)
+
+	if settled.Goal != "" {
+		publishGoalProgress(settled.Goal)
+	}
+
+	publishInvoiceEvent(invoiceEvent{
+		RHash: settled.RHash,
+		State: database.InvoiceSettled,
+	})
+
+	queueWebhook(newWebhookPayload(webhookInvoiceSettled, settled))
+
+	sendTipMail(settled.Jar, settled.AmountMsat, settled.Message)
+
+}
+
+// Keysend payments are not related to an invoice of LightningTip and can be recorded right away
+func publishKeysendTip(payment backends.SettledInvoice) {
+	id, added := database.AddKeysendTip(payment.RHash, payment.AmountMsat, payment.Message, cfg.TipWallApproval)
+
+	if !added {
+		return
+	}
+
+	addPayoutShares(id, "", payment.AmountMsat)
+
+	logMessage := "Received keysend tip of " + rates.FormatMsat(payment.AmountMsat) + " satoshis"
+
+	if payment.Message != "" {
+		logMessage += " with message \"" + payment.Message + "\""
+	}
+
+	log.Info(logMessage)
+
+	tip := PendingInvoice{
+		RHash:      payment.RHash,
+		AmountMsat: payment.AmountMsat,
+		Message:    payment.Message,
+	}
+
+	publishTip(id, tip)
+
+	payload := newWebhookPayload(webhookInvoiceSettled, tip)
+	payload.Keysend = true
+
+	queueWebhook(payload)
+
+	sendTipMail("", payment.AmountMsat, payment.Message)
+
 }
 
 func invoiceSettledHandler(writer http.ResponseWriter, request *http.Request) {
@@ -279,19 +536,8 @@ func invoiceSettledHandler(writer http.ResponseWriter, request *http.Request) {
 
 		if err == nil {
 			if body.RHash != "" {
-				settled := true
-
-				for _, pending := range pendingInvoices {
-					if pending.RHash == body.RHash {
-						settled = false
-
-						break
-					}
-
-				}
-
 				writer.Write(marshalJSON(invoiceSettledResponse{
-					Settled: settled,
+					Settled: getInvoiceState(body.RHash, true).State == database.InvoiceSettled,
 				}))
 
 				return
@@ -307,6 +553,89 @@ func invoiceSettledHandler(writer http.ResponseWriter, request *http.Request) {
 	writeError(writer, errorMessage)
 }
 
+func invoiceStateHandler(writer http.ResponseWriter, request *http.Request) {
+	rHash := strings.TrimPrefix(request.URL.Path, "/invoice/")
+
+	if request.Method == http.MethodGet && rHash != "" {
+		writer.Write(marshalJSON(getInvoiceState(rHash, true)))
+
+		return
+	}
+
+	log.Error(couldNotParseError)
+
+	writeError(writer, couldNotParseError)
+}
+
+// Looks up the state of an invoice in the pending invoices, the database and as last resort asks the backend
+// The backend is asked only if askBackend is set because the streams would allow flooding it with requests
+func getInvoiceState(rHash string, askBackend bool) invoiceStateResponse {
+	if pending, ok := pendingInvoices.GetByRHash(rHash); ok {
+		state := database.InvoicePending
+
+		// The timer that removes expired invoices from the registry might not have fired yet
+		if pending.Expiry.Before(time.Now()) {
+			state = database.InvoiceExpired
+		}
+
+		return invoiceStateResponse{
+			State:      state,
+			Amount:     pending.AmountMsat / 1000,
+			AmountMsat: pending.AmountMsat,
+			Fiat:       pending.Fiat,
+			Currency:   pending.Currency,
+			Rate:       pending.Rate,
+			Expiry:     pending.Expiry.Unix(),
+		}
+	}
+
+	invoice, err := database.GetInvoice(rHash)
+
+	if err == nil {
+		response := invoiceStateResponse{
+			State:      invoice.State,
+			Amount:     invoice.AmountMsat / 1000,
+			AmountMsat: invoice.AmountMsat,
+			Fiat:       invoice.Fiat,
+			Currency:   invoice.Currency,
+			Rate:       invoice.Rate,
+			Expiry:     invoice.Expiry.Unix(),
+		}
+
+		if !invoice.SettleDate.IsZero() {
+			response.SettleDate = invoice.SettleDate.Unix()
+		}
+
+		return response
+	}
+
+	if err != sql.ErrNoRows {
+		log.Warning("Failed to look up invoice in database: " + fmt.Sprint(err))
+	}
+
+	if askBackend && isPaymentHash(rHash) {
+		settled, err := backend.InvoiceSettled(rHash)
+
+		if err == nil && settled {
+			return invoiceStateResponse{
+				State: database.InvoiceSettled,
+			}
+		}
+
+	}
+
+	return invoiceStateResponse{
+		State: invoiceUnknown,
+	}
+}
+
+// Payment hashes are hex encoded SHA256 hashes
+func isPaymentHash(rHash string) bool {
+	decoded, err := hex.DecodeString(rHash)
+
+	return err == nil && len(decoded) == sha256.Size
+}
+
 func getInvoiceHandler(writer http.ResponseWriter, request *http.Request) {
 	errorMessage := couldNotParseError
 
@@ -318,11 +647,73 @@ func getInvoiceHandler(writer http.ResponseWriter, request *http.Request) {
 		err := json.Unmarshal(data, &body)
 
 		if err == nil {
-			if body.Amount != 0 {
-				invoice, paymentHash, err := backend.GetInvoice(body.Message, body.Amount, cfg.TipExpiry)
+			amountMsat := body.AmountMsat
+
+			var rate float64
+
+			errorMessage = ""
+
+			// Negative amounts and ones that are too big would overflow when converted to millisatoshis
+			if body.Amount < 0 || body.AmountMsat < 0 {
+				errorMessage = "Tip amount must be positive"
+
+			} else if body.AmountMsat == 0 && body.Amount > math.MaxInt64/1000 {
+				errorMessage = tipAmountTooBig
+
+			} else if amountMsat == 0 {
+				amountMsat = body.Amount * 1000
+			}
+
+			if body.Fiat != 0 {
+				body.Currency = strings.ToUpper(strings.TrimSpace(body.Currency))
+
+				if errorMessage == "" {
+					amountMsat, rate, errorMessage = convertFiat(body.Fiat, body.Currency)
+				}
+
+			} else {
+				body.Currency = ""
+			}
+
+			if errorMessage == "" {
+				errorMessage = validateTipAmount(amountMsat)
+			}
+
+			body.Nickname = strings.TrimSpace(body.Nickname)
+
+			if errorMessage == "" && len([]rune(body.Nickname)) > maxNicknameLength {
+				errorMessage = "Nickname must not be longer than " + strconv.Itoa(maxNicknameLength) + " characters"
+			}
+
+			if errorMessage == "" && body.Goal != "" {
+				errorMessage = validateGoal(body.Goal)
+			}
+
+			if errorMessage == "" && body.Jar != "" {
+				errorMessage = validateJar(body.Jar, strings.TrimSuffix(body.Message, "\n"))
+			}
+
+			if errorMessage == "" {
+				invoice, paymentHash, preimage, err := createInvoice(getInvoiceOptions(body.Message, amountMsat))
 
 				if err == nil {
-					logMessage := "Created invoice with amount of " + strconv.FormatInt(body.Amount, 10) + " satoshis"
+					logMessage := "Created invoice with amount of " + rates.FormatMsat(amountMsat) + " satoshis"
+
+					if rate != 0 {
+						logMessage += " (" + strconv.FormatFloat(body.Fiat, 'f', -1, 64) + " " + body.Currency + ")"
+					}
+
+					if body.Jar != "" {
+						logMessage += " for jar \"" + body.Jar + "\""
+					}
+
+					if body.Goal != "" {
+						logMessage += " for goal \"" + body.Goal + "\""
+					}
+
+					if body.Nickname != "" {
+						logMessage += " from \"" + body.Nickname + "\""
+					}
 
 					if body.Message != "" {
 						// Deletes new lines at the end of the messages
@@ -335,30 +726,38 @@ func getInvoiceHandler(writer http.ResponseWriter, request *http.Request) {
 
 					log.Info(logMessage)
 
-					pendingInvoices = append(pendingInvoices, PendingInvoice{
-						Invoice: invoice,
-						Amount:  body.Amount,
-						Message: body.Message,
-						RHash:   string(paymentHash),
-						Expiry:  time.Now().Add(expiryDuration),
-					})
+					pending := PendingInvoice{
+						Invoice:    invoice,
+						AmountMsat: amountMsat,
+						Message:    body.Message,
+						Nickname:   body.Nickname,
+						Goal:       body.Goal,
+						Jar:        body.Jar,
+						RHash:      paymentHash,
+						Expiry:     time.Now().Add(expiryDuration),
+						Fiat:       body.Fiat,
+						Currency:   body.Currency,
+						Rate:       rate,
+						Preimage:   preimage,
+					}
+
+					addPendingInvoice(pending)
 
 					writer.Write(marshalJSON(invoiceResponse{
-						Invoice: invoice,
-						RHash:   paymentHash,
-						Expiry:  cfg.TipExpiry,
+						Invoice:    invoice,
+						RHash:      paymentHash,
+						Expiry:     cfg.TipExpiry,
+						AmountMsat: amountMsat,
+						Currency:   body.Currency,
+						Rate:       rate,
 					}))
 
 					return
 				}
 
-				errorMessage = "Failed to create invoice"
+				log.Debug("Failed to create invoice: " + fmt.Sprint(err))
 
-				// This is way too hacky
-				// Maybe a cast to the gRPC error and get its error message directly
-				if fmt.Sprint(err)[:47] == "rpc error: code = Unknown desc = memo too large" {
-					errorMessage += ": message too long"
-				}
+				errorMessage = "Failed to create invoice"
 
 			}
 
@@ -371,6 +770,106 @@ func getInvoiceHandler(writer http.ResponseWriter, request *http.Request) {
 	writeError(writer, errorMessage)
 }
 
+// Creates a hold invoice if they are enabled. The preimage is only returned for hold invoices
+func createInvoice(options backends.InvoiceOptions) (invoice string, rHash string, preimage string, err error) {
+	if cfg.HoldInvoices != holdModeOff {
+		return addHoldInvoice(options)
+	}
+
+	invoice, rHash, err = backend.GetInvoice(options)
+
+	return invoice, rHash, "", err
+}
+
+// Messages that are too long to fit into an invoice are committed to by their hash
+func getInvoiceOptions(message string, amountMsat int64) backends.InvoiceOptions {
+	return backends.InvoiceOptions{
+		Description:     message,
+		HashDescription: len(message) > maxDescriptionLength,
+		AmountMsat:      amountMsat,
+		Expiry:          cfg.TipExpiry,
+		Private:         cfg.PrivateInvoices,
+		FallbackAddr:    cfg.FallbackAddress,
+	}
+}
+
+// Converts an amount of fiat into millisatoshis rounded to whole satoshis because not all backends support
+// fractional ones. Returns an error message if the conversion is not possible
+func convertFiat(fiat float64, currency string) (amountMsat int64, rate float64, errorMessage string) {
+	if rateProvider == nil {
+		return 0, 0, "Tips can't be denominated in fiat"
+	}
+
+	if fiat < 0 || math.IsNaN(fiat) || math.IsInf(fiat, 0) {
+		return 0, 0, "Tip amount must be positive"
+	}
+
+	if currency == "" {
+		return 0, 0, "Currency of the fiat amount is missing"
+	}
+
+	rate, err := rateProvider.Rate(currency)
+
+	if err != nil {
+		log.Warning("Failed to get exchange rate of " + currency + ": " + fmt.Sprint(err))
+
+		if err == rates.ErrUnknownCurrency {
+			return 0, 0, "Unknown currency: " + currency
+		}
+
+		return 0, 0, "Failed to get exchange rate"
+	}
+
+	if fiat/rate*1e11 >= math.MaxInt64 {
+		return 0, 0, tipAmountTooBig
+	}
+
+	amountMsat = rates.ToMsat(fiat, rate)
+
+	return amountMsat - amountMsat%1000, rate, ""
+}
+
+// Returns an empty string if the amount in millisatoshis is valid
+func validateTipAmount(amountMsat int64) string {
+	if amountMsat < cfg.MinTip*1000 {
+		if amountMsat <= 0 {
+			return "Tip amount must be positive"
+		}
+
+		return "Tip amount must be at least " + strconv.FormatInt(cfg.MinTip, 10) + " satoshis"
+	}
+
+	if cfg.MaxTip > 0 && amountMsat > cfg.MaxTip*1000 {
+		return "Tip amount must not exceed " + strconv.FormatInt(cfg.MaxTip, 10) + " satoshis"
+	}
+
+	if amountMsat > maxTipAmountMsat {
+		return tipAmountTooBig
+	}
+
+	return ""
+}
+
+func configHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeError(writer, couldNotParseError)
+
+		return
+	}
+
+	presets := cfg.TipPresets
+
+	if presets == nil {
+		presets = []int64{}
+	}
+
+	writer.Write(marshalJSON(configResponse{
+		MinTip:     cfg.MinTip,
+		MaxTip:     cfg.MaxTip,
+		TipPresets: presets,
+	}))
+}
+
 func notFoundHandler(writer http.ResponseWriter, request *http.Request) {
 	if request.RequestURI == "/" {
 		writeError(writer, "This is an API to connect LND and your website. You should not open this in your browser")
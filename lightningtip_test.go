@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/donovanhide/eventsource"
+	"github.com/michael1011/lightningtip/backends"
+	"github.com/michael1011/lightningtip/database"
+	"github.com/michael1011/lightningtip/notifications"
+	"github.com/michael1011/lightningtip/rates"
+)
+
+// Exchange rates that don't need a file or an API
+type fixedRates map[string]float64
+
+func (fixed fixedRates) Rate(currency string) (float64, error) {
+	if rate, ok := fixed[currency]; ok {
+		return rate, nil
+	}
+
+	return 0, rates.ErrUnknownCurrency
+}
+
+// Uses the mock backend and a temporary database. The config is restored by the returned function
+func setUpMockBackend(t *testing.T) (mock *backends.Mock, tearDown func()) {
+	dir, err := ioutil.TempDir("", "lightningtip")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = database.InitDatabase(path.Join(dir, "tips.db")); err != nil {
+		t.Fatal(err)
+	}
+
+	mock = &backends.Mock{}
+
+	if err = mock.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	previousCfg := cfg
+	previousBackend := backend
+	previousRates := rateProvider
+
+	cfg.MinTip = 1
+	cfg.TipExpiry = 3600
+	cfg.Webhook = &notifications.Webhook{}
+
+	backend = mock
+	eventSrv = eventsource.NewServer()
+
+	return mock, func() {
+		eventSrv.Close()
+
+		cfg = previousCfg
+		backend = previousBackend
+		rateProvider = previousRates
+
+		os.RemoveAll(dir)
+	}
+}
+
+// Sends a request to a handler and decodes its response. The status code is returned too
+func callHandler(t *testing.T, handler http.HandlerFunc, method string, body string, response interface{}) int {
+	recorder := httptest.NewRecorder()
+
+	handler(recorder, httptest.NewRequest(method, "/", strings.NewReader(body)))
+
+	if response != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+			t.Fatalf("could not decode response %s: %v", recorder.Body.String(), err)
+		}
+
+	}
+
+	return recorder.Code
+}
+
+func TestGetInvoiceAmount(t *testing.T) {
+	_, tearDown := setUpMockBackend(t)
+	defer tearDown()
+
+	cfg.MaxTip = 100000
+	rateProvider = fixedRates{"EUR": 50000}
+
+	tests := []struct {
+		body       string
+		amountMsat int64
+		err        string
+	}{
+		{`{"Amount": 21}`, 21000, ""},
+		{`{"AmountMsat": 21500}`, 21500, ""},
+		{`{"Fiat": 1, "Currency": "eur"}`, 2000000, ""},
+		{`{"Amount": 0}`, 0, "Tip amount must be positive"},
+		{`{"Amount": -18446744073709550}`, 0, "Tip amount must be positive"},
+		{`{"AmountMsat": -1000}`, 0, "Tip amount must be positive"},
+		{`{"Amount": 18446744073709553}`, 0, tipAmountTooBig},
+		{`{"Amount": 18446744073709553, "Fiat": 1, "Currency": "EUR"}`, 0, tipAmountTooBig},
+		{`{"AmountMsat": 500}`, 0, "Tip amount must be at least 1 satoshis"},
+		{`{"Amount": 100001}`, 0, "Tip amount must not exceed 100000 satoshis"},
+		{`{"Fiat": 1, "Currency": "XYZ"}`, 0, "Unknown currency: XYZ"},
+		{`{"Fiat": -1, "Currency": "EUR"}`, 0, "Tip amount must be positive"},
+		{`not json`, 0, couldNotParseError},
+	}
+
+	for _, test := range tests {
+		var response struct {
+			invoiceResponse
+			errorResponse
+		}
+
+		code := callHandler(t, getInvoiceHandler, http.MethodPost, test.body, &response)
+
+		if test.err != "" {
+			if code != http.StatusBadRequest || response.Error != test.err {
+				t.Errorf("unexpected response to %s: %d %v", test.body, code, response)
+			}
+
+			continue
+		}
+
+		if code != http.StatusOK || response.Invoice == "" || response.AmountMsat != test.amountMsat {
+			t.Errorf("unexpected response to %s: %d %v", test.body, code, response)
+		}
+
+	}
+
+	if code := callHandler(t, getInvoiceHandler, http.MethodGet, "", nil); code != http.StatusBadRequest {
+		t.Errorf("GET request was answered with %d", code)
+	}
+
+}
+
+func TestConfigHandler(t *testing.T) {
+	_, tearDown := setUpMockBackend(t)
+	defer tearDown()
+
+	cfg.MinTip = 100
+	cfg.MaxTip = 0
+
+	var response configResponse
+
+	if code := callHandler(t, configHandler, http.MethodGet, "", &response); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+
+	// Presets that are not set must not be null for the frontend
+	if response.MinTip != 100 || response.MaxTip != 0 || response.TipPresets == nil || len(response.TipPresets) != 0 {
+		t.Errorf("unexpected config %v", response)
+	}
+
+	cfg.TipPresets = []int64{100, 1000}
+
+	callHandler(t, configHandler, http.MethodGet, "", &response)
+
+	if len(response.TipPresets) != 2 || response.TipPresets[1] != 1000 {
+		t.Errorf("unexpected presets %v", response.TipPresets)
+	}
+
+	if code := callHandler(t, configHandler, http.MethodPost, "", nil); code != http.StatusBadRequest {
+		t.Errorf("POST request was answered with %d", code)
+	}
+
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/lightningnetwork/lnd/zpay32"
+	"github.com/michael1011/lightningtip/rates"
+)
+
+// Lightning Addresses (LUD-16) are resolved by wallets to the LNURL-pay (LUD-06) endpoint under this path
+const lnurlPayPath = "/.well-known/lnurlp/"
+
+const lnurlCallbackPath = "/lnurlp/callback/"
+
+// Client for the requests to the LNURL servers of Lightning Addresses that shares of tips are paid out to
+var lnurlClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+type lnurlPayResponse struct {
+	Tag            string `json:"tag"`
+	Callback       string `json:"callback"`
+	MinSendable    int64  `json:"minSendable"`
+	MaxSendable    int64  `json:"maxSendable"`
+	Metadata       string `json:"metadata"`
+	CommentAllowed int64  `json:"commentAllowed,omitempty"`
+}
+
+type lnurlCallbackResponse struct {
+	PR     string        `json:"pr"`
+	Routes []interface{} `json:"routes"`
+}
+
+type lnurlErrorResponse struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+func lnurlPayHandler(writer http.ResponseWriter, request *http.Request) {
+	name, ok := getLNURLName(request, lnurlPayPath)
+
+	if !ok {
+		writeLNURLError(writer, "Unknown Lightning Address")
+
+		return
+	}
+
+	maxSendable := int64(maxTipAmountMsat)
+
+	if cfg.MaxTip > 0 {
+		maxSendable = cfg.MaxTip * 1000
+	}
+
+	writeLNURLResponse(writer, lnurlPayResponse{
+		Tag:            "payRequest",
+		Callback:       getLNURLBaseURL(request) + lnurlCallbackPath + name,
+		MinSendable:    cfg.MinTip * 1000,
+		MaxSendable:    maxSendable,
+		Metadata:       getLNURLMetadata(request, name),
+		CommentAllowed: cfg.LNURL.CommentAllowed,
+	})
+}
+
+// Creates an invoice that commits to the hash of the metadata and tracks it like the ones created via "/getinvoice"
+func lnurlCallbackHandler(writer http.ResponseWriter, request *http.Request) {
+	name, ok := getLNURLName(request, lnurlCallbackPath)
+
+	if !ok {
+		writeLNURLError(writer, "Unknown Lightning Address")
+
+		return
+	}
+
+	amountMsat, err := strconv.ParseInt(request.FormValue("amount"), 10, 64)
+
+	if err != nil {
+		writeLNURLError(writer, couldNotParseError)
+
+		return
+	}
+
+	if errorMessage := validateTipAmount(amountMsat); errorMessage != "" {
+		writeLNURLError(writer, errorMessage)
+
+		return
+	}
+
+	// Comments are ignored if they are not allowed (LUD-12)
+	var message string
+
+	if cfg.LNURL.CommentAllowed > 0 {
+		message = strings.TrimSuffix(request.FormValue("comment"), "\n")
+
+		if int64(len([]rune(message))) > cfg.LNURL.CommentAllowed {
+			writeLNURLError(writer, "Comment must not be longer than "+strconv.FormatInt(cfg.LNURL.CommentAllowed, 10)+" characters")
+
+			return
+		}
+
+	}
+
+	options := getInvoiceOptions(getLNURLMetadata(request, name), amountMsat)
+	options.HashDescription = true
+
+	invoice, paymentHash, preimage, err := createInvoice(options)
+
+	if err != nil {
+		log.Error("Failed to create invoice for Lightning Address: " + fmt.Sprint(err))
+
+		writeLNURLError(writer, "Failed to create invoice")
+
+		return
+	}
+
+	logMessage := "Created invoice for Lightning Address \"" + name + "\" with amount of " + rates.FormatMsat(amountMsat) + " satoshis"
+
+	if message != "" {
+		logMessage += " with message \"" + message + "\""
+	}
+
+	log.Info(logMessage)
+
+	addPendingInvoice(PendingInvoice{
+		Invoice:    invoice,
+		AmountMsat: amountMsat,
+		Message:    message,
+		RHash:      paymentHash,
+		Expiry:     time.Now().Add(time.Duration(cfg.TipExpiry) * time.Second),
+		Preimage:   preimage,
+	})
+
+	writeLNURLResponse(writer, lnurlCallbackResponse{
+		PR:     invoice,
+		Routes: []interface{}{},
+	})
+}
+
+// Gets the name of the Lightning Address after the prefix of the path and checks whether it is configured
+func getLNURLName(request *http.Request, prefix string) (string, bool) {
+	if request.Method != http.MethodGet {
+		return "", false
+	}
+
+	name := strings.ToLower(strings.TrimPrefix(request.URL.Path, prefix))
+
+	for _, configured := range cfg.LNURL.Names {
+		if strings.ToLower(configured) == name {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// Reverse proxies can serve LightningTip under another host or a path which is why the URL can be configured
+func getLNURLBaseURL(request *http.Request) string {
+	if cfg.LNURL.URL != "" {
+		return strings.TrimSuffix(cfg.LNURL.URL, "/")
+	}
+
+	return "https://" + request.Host
+}
+
+// The metadata has to be exactly the same string in both responses because the invoice commits to its hash
+func getLNURLMetadata(request *http.Request, name string) string {
+	domain := request.Host
+
+	if parsed, err := url.Parse(getLNURLBaseURL(request)); err == nil && parsed.Hostname() != "" {
+		domain = parsed.Hostname()
+	}
+
+	metadata, _ := json.Marshal([][]string{
+		{"text/plain", cfg.LNURL.Description},
+		{"text/identifier", name + "@" + domain},
+	})
+
+	return string(metadata)
+}
+
+// The endpoints are served with "handleHeaders" which is why web wallets need "accessdomain" to be set to "*"
+func writeLNURLResponse(writer http.ResponseWriter, data interface{}) {
+	response, _ := json.Marshal(data)
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	writer.Write(response)
+}
+
+// Errors are sent with status 200 because not all wallets read the body of other responses
+func writeLNURLError(writer http.ResponseWriter, reason string) {
+	writeLNURLResponse(writer, lnurlErrorResponse{
+		Status: "ERROR",
+		Reason: reason,
+	})
+}
+
+// Gets an invoice for the amount from the LNURL server of a Lightning Address
+func resolveLightningAddress(address string, amountMsat int64) (invoice string, err error) {
+	parts := strings.Split(address, "@")
+
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", errors.New("invalid Lightning Address: " + address)
+	}
+
+	var payResponse lnurlPayResponse
+
+	err = getLNURL("https://"+parts[1]+lnurlPayPath+parts[0], &payResponse)
+
+	if err != nil {
+		return "", err
+	}
+
+	if payResponse.Tag != "payRequest" {
+		return "", errors.New("Lightning Address does not accept payments")
+	}
+
+	if amountMsat < payResponse.MinSendable || amountMsat > payResponse.MaxSendable {
+		return "", errors.New("Lightning Address accepts only between " + rates.FormatMsat(payResponse.MinSendable) + " and " +
+			rates.FormatMsat(payResponse.MaxSendable) + " satoshis")
+	}
+
+	callback, err := url.Parse(payResponse.Callback)
+
+	if err != nil {
+		return "", err
+	}
+
+	query := callback.Query()
+	query.Set("amount", strconv.FormatInt(amountMsat, 10))
+
+	callback.RawQuery = query.Encode()
+
+	var callbackResponse lnurlCallbackResponse
+
+	err = getLNURL(callback.String(), &callbackResponse)
+
+	if err != nil {
+		return "", err
+	}
+
+	decoded, err := decodeInvoice(callbackResponse.PR)
+
+	if err != nil {
+		return "", err
+	}
+
+	// The LNURL server must not be able to make us pay more than we asked for
+	if decoded.MilliSat == nil || int64(*decoded.MilliSat) != amountMsat {
+		return "", errors.New("amount of invoice of Lightning Address does not match")
+	}
+
+	// The invoice has to commit to the metadata to prove that it is for the Lightning Address (LUD-06)
+	if decoded.DescriptionHash == nil || *decoded.DescriptionHash != sha256.Sum256([]byte(payResponse.Metadata)) {
+		return "", errors.New("description hash of invoice of Lightning Address does not match its metadata")
+	}
+
+	return callbackResponse.PR, err
+}
+
+func getLNURL(location string, result interface{}) error {
+	response, err := lnurlClient.Get(location)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return err
+	}
+
+	var lnurlError lnurlErrorResponse
+
+	if json.Unmarshal(data, &lnurlError) == nil && lnurlError.Status == "ERROR" {
+		return errors.New("LNURL error: " + lnurlError.Reason)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return errors.New("unexpected response status of LNURL server: " + response.Status)
+	}
+
+	return json.Unmarshal(data, result)
+}
+
+// Networks that invoices can be for. Ones whose prefix starts with the one of another have to come first
+var invoiceNetworks = []*chaincfg.Params{
+	&chaincfg.RegressionNetParams,
+	&chaincfg.SigNetParams,
+	&chaincfg.TestNet3Params,
+	&chaincfg.MainNetParams,
+}
+
+// Decodes a BOLT11 invoice of any network
+func decodeInvoice(invoice string) (*zpay32.Invoice, error) {
+	lower := strings.ToLower(invoice)
+
+	for _, network := range invoiceNetworks {
+		prefix := "ln" + network.Bech32HRPSegwit
+
+		// Signet uses the same prefix as testnet for addresses but not for invoices
+		if network == &chaincfg.SigNetParams {
+			prefix = "lntbs"
+		}
+
+		if strings.HasPrefix(lower, prefix) {
+			return zpay32.Decode(invoice, network)
+		}
+
+	}
+
+	return nil, errors.New("invalid invoice")
+}
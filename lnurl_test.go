@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// Sends a GET request to a LNURL endpoint on "example.com" and decodes its response
+func callLNURLHandler(t *testing.T, handler http.HandlerFunc, target string, response interface{}) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+
+	handleHeaders(handler).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d of %s", recorder.Code, target)
+	}
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+		t.Fatalf("could not decode response %s: %v", recorder.Body.String(), err)
+	}
+
+	return recorder
+}
+
+// Sets up Lightning Addresses for the name "tips" that allow tips between 1 and 1000 satoshis
+func setUpLNURL(t *testing.T) func() {
+	_, tearDown := setUpMockBackend(t)
+
+	cfg.MaxTip = 1000
+	cfg.AccessDomain = "*"
+
+	cfg.LNURL = &lnurlOptions{
+		Names:          []string{"Tips"},
+		Description:    "Tip",
+		CommentAllowed: 10,
+	}
+
+	return tearDown
+}
+
+func TestLNURLPayHandler(t *testing.T) {
+	defer setUpLNURL(t)()
+
+	var response lnurlPayResponse
+
+	recorder := callLNURLHandler(t, lnurlPayHandler, lnurlPayPath+"tips", &response)
+
+	if origin := recorder.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
+		t.Errorf("unexpected allowed origin %s", origin)
+	}
+
+	if response.Tag != "payRequest" || response.MinSendable != 1000 || response.MaxSendable != 1000000 || response.CommentAllowed != 10 {
+		t.Errorf("unexpected pay response %v", response)
+	}
+
+	if response.Callback != "https://example.com"+lnurlCallbackPath+"tips" ||
+		response.Metadata != `[["text/plain","Tip"],["text/identifier","tips@example.com"]]` {
+
+		t.Errorf("unexpected callback %s or metadata %s", response.Callback, response.Metadata)
+	}
+
+	// Reverse proxies can serve LightningTip on another domain and under a path
+	cfg.LNURL.URL = "https://proxy.example/lightningtip/"
+
+	callLNURLHandler(t, lnurlPayHandler, lnurlPayPath+"tips", &response)
+
+	if response.Callback != "https://proxy.example/lightningtip"+lnurlCallbackPath+"tips" ||
+		response.Metadata != `[["text/plain","Tip"],["text/identifier","tips@proxy.example"]]` {
+
+		t.Errorf("unexpected callback %s or metadata %s behind proxy", response.Callback, response.Metadata)
+	}
+
+	var lnurlError lnurlErrorResponse
+
+	if callLNURLHandler(t, lnurlPayHandler, lnurlPayPath+"alice", &lnurlError); lnurlError.Status != "ERROR" {
+		t.Errorf("unknown Lightning Address was answered with %v", lnurlError)
+	}
+
+}
+
+func TestLNURLCallbackHandler(t *testing.T) {
+	defer setUpLNURL(t)()
+
+	var payResponse lnurlPayResponse
+
+	callLNURLHandler(t, lnurlPayHandler, lnurlPayPath+"tips", &payResponse)
+
+	callback := func(amountMsat string, comment string) (response lnurlCallbackResponse, lnurlError lnurlErrorResponse) {
+		query := url.Values{}
+		query.Set("amount", amountMsat)
+
+		if comment != "" {
+			query.Set("comment", comment)
+		}
+
+		var result struct {
+			lnurlCallbackResponse
+			lnurlErrorResponse
+		}
+
+		callLNURLHandler(t, lnurlCallbackHandler, lnurlCallbackPath+"tips?"+query.Encode(), &result)
+
+		return result.lnurlCallbackResponse, result.lnurlErrorResponse
+	}
+
+	response, _ := callback("21000", "thanks")
+
+	decoded, err := decodeInvoice(response.PR)
+
+	if err != nil {
+		t.Fatalf("could not decode invoice %s: %v", response.PR, err)
+	}
+
+	if decoded.MilliSat == nil || *decoded.MilliSat != 21000 {
+		t.Errorf("unexpected amount of invoice %v", decoded.MilliSat)
+	}
+
+	// Wallets check that the invoice commits to the metadata of the pay response
+	if decoded.DescriptionHash == nil || *decoded.DescriptionHash != sha256.Sum256([]byte(payResponse.Metadata)) {
+		t.Error("description hash of invoice does not match metadata")
+	}
+
+	if pending, ok := pendingInvoices.GetByInvoice(response.PR); !ok || pending.AmountMsat != 21000 || pending.Message != "thanks" {
+		t.Errorf("unexpected pending invoice %v", pending)
+	}
+
+	invalidAmounts := map[string]string{
+		"999":     "Tip amount must be at least 1 satoshis",
+		"1000001": "Tip amount must not exceed 1000 satoshis",
+		"-1000":   "Tip amount must be positive",
+		"a lot":   couldNotParseError,
+	}
+
+	for amountMsat, expected := range invalidAmounts {
+		if response, lnurlError := callback(amountMsat, ""); response.PR != "" || lnurlError.Status != "ERROR" || lnurlError.Reason != expected {
+			t.Errorf("unexpected response to amount %s: %v", amountMsat, lnurlError)
+		}
+
+	}
+
+	// The limit of comments counts characters and not bytes
+	if response, _ = callback("1000", "ünïcödé!!!"); response.PR == "" {
+		t.Error("comment with allowed length was rejected")
+	}
+
+	if _, lnurlError := callback("1000", "01234567890"); lnurlError.Reason != "Comment must not be longer than 10 characters" {
+		t.Errorf("too long comment was answered with %v", lnurlError)
+	}
+
+	// Comments are dropped when they are not allowed
+	cfg.LNURL.CommentAllowed = 0
+
+	response, _ = callback("1000", "01234567890")
+
+	if pending, ok := pendingInvoices.GetByInvoice(response.PR); !ok || pending.Message != "" {
+		t.Errorf("comment was stored although comments are not allowed %v", pending)
+	}
+
+}
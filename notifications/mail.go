@@ -6,7 +6,8 @@ import (
 	"net"
 	"net/smtp"
 	"os/exec"
-	"strconv"
+
+	"github.com/michael1011/lightningtip/rates"
 )
 
 // Mail contains all values needed to be able to send a mail
@@ -27,9 +28,9 @@ const newLine = "\r\n"
 
 const subject = "You received a tip"
 
-// SendMail sends a mail
-func (mail *Mail) SendMail(amount int64, message string) {
-	body := "You received a tip of " + strconv.FormatInt(amount, 10) + " satoshis"
+// SendMail sends a mail. The amount is denominated in millisatoshis
+func (mail *Mail) SendMail(amountMsat int64, message string) {
+	body := "You received a tip of " + rates.FormatMsat(amountMsat) + " satoshis"
 
 	if message != "" {
 		body += " with the message \"" + message + "\""
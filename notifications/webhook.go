@@ -0,0 +1,82 @@
+package notifications
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/michael1011/lightningtip/version"
+)
+
+// Webhook contains all values needed to be able to post events to HTTP endpoints
+type Webhook struct {
+	URLs   []string `long:"url" Description:"URL to which events are posted. Can be set multiple times"`
+	Secret string   `long:"secret" Description:"Secret with which the HMAC-SHA256 signatures of the events are created"`
+
+	Timeout       int64 `long:"timeout" Description:"Seconds after which requests to the URLs are aborted"`
+	RetryInterval int64 `long:"retryinterval" Description:"Seconds before the first retry of a failed delivery. The delay doubles with every failed attempt"`
+	MaxAttempts   int64 `long:"maxattempts" Description:"How often delivering an event is attempted before it is marked as failed"`
+
+	client *http.Client
+}
+
+// Headers of the requests. The signature is the hex encoded HMAC-SHA256 of the body with the prefix "sha256="
+// and the delivery ID is the same for all attempts to deliver an event which allows receivers to ignore duplicates
+const (
+	webhookSignatureHeader = "X-LightningTip-Signature"
+	webhookDeliveryHeader  = "X-LightningTip-Delivery"
+)
+
+// Send posts the payload of an event to a URL. Responses with a status other than 2xx are errors
+func (webhook *Webhook) Send(url string, delivery int64, payload []byte) (status int, err error) {
+	if webhook.client == nil {
+		webhook.client = &http.Client{
+			Timeout: time.Duration(webhook.Timeout) * time.Second,
+		}
+	}
+
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "LightningTip/"+version.Version)
+	request.Header.Set(webhookDeliveryHeader, strconv.FormatInt(delivery, 10))
+
+	if webhook.Secret != "" {
+		request.Header.Set(webhookSignatureHeader, "sha256="+webhook.Sign(payload))
+	}
+
+	response, err := webhook.client.Do(request)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// Reading the body allows the connection to be reused
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, errors.New("unexpected response status: " + response.Status)
+	}
+
+	return response.StatusCode, err
+}
+
+// Sign creates the hex encoded HMAC-SHA256 of the payload with the secret
+func (webhook *Webhook) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write(payload)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
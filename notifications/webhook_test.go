@@ -0,0 +1,72 @@
+package notifications
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookSend(t *testing.T) {
+	payload := []byte(`{"Event":"invoice.settled"}`)
+
+	var received *http.Request
+	var body []byte
+
+	status := http.StatusNoContent
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		received = request
+		body, _ = ioutil.ReadAll(request.Body)
+
+		writer.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	webhook := &Webhook{
+		Secret:  "secret",
+		Timeout: 10,
+	}
+
+	if code, err := webhook.Send(server.URL, 42, payload); err != nil || code != status {
+		t.Fatalf("unexpected result %d: %v", code, err)
+	}
+
+	if string(body) != string(payload) || received.Header.Get("Content-Type") != "application/json" ||
+		received.Header.Get(webhookDeliveryHeader) != "42" {
+
+		t.Errorf("unexpected request %v with body %s", received.Header, body)
+	}
+
+	// Receivers verify the signature with the secret
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(payload)
+
+	if signature := received.Header.Get(webhookSignatureHeader); signature != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("unexpected signature %s", signature)
+	}
+
+	// Responses with a status other than 2xx are errors
+	for _, status = range []int{http.StatusNotFound, http.StatusInternalServerError} {
+		if code, err := webhook.Send(server.URL, 42, payload); err == nil || code != status {
+			t.Errorf("response with status %d was answered with %d: %v", status, code, err)
+		}
+
+	}
+
+	// Events are not signed without secret
+	webhook.Secret = ""
+	status = http.StatusOK
+
+	if _, err := webhook.Send(server.URL, 43, payload); err != nil || received.Header.Get(webhookSignatureHeader) != "" {
+		t.Errorf("event was signed without secret: %v", err)
+	}
+
+	if _, err := webhook.Send("http://127.0.0.1:0", 44, payload); err == nil {
+		t.Error("unreachable URL did not cause an error")
+	}
+
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michael1011/lightningtip/backends"
+	"github.com/michael1011/lightningtip/database"
+	"github.com/michael1011/lightningtip/rates"
+)
+
+// Kinds of destinations of splits
+const (
+	destinationLightningAddress = "Lightning Address"
+	destinationKeysend          = "keysend"
+	destinationOffer            = "offer"
+)
+
+type payoutOptions struct {
+	Splits      []string `long:"split" description:"Share of the tips for a jar that is paid out in the format jar:percent:destination. Can be set multiple times"`
+	Interval    int64    `long:"interval" description:"Seconds between collecting the shares into payouts and sending them"`
+	MinAmount   int64    `long:"minamount" description:"Amount in satoshis that has to be collected for a destination before it is paid out"`
+	MaxFee      float64  `long:"maxfee" description:"Maximal routing fee of payouts in percent of their amount"`
+	MinFee      int64    `long:"minfee" description:"Routing fee in satoshis that payouts may use even if it is more than maxfee percent of their amount"`
+	MaxAttempts int64    `long:"maxattempts" description:"How often sending a payout is attempted before it is marked as failed"`
+}
+
+// split is the share of the tips for a jar that is paid out to a collaborator
+type split struct {
+	Jar         string
+	Percent     float64
+	Destination string
+}
+
+// The splits from the config by the name of their jar. Tips without a jar have an empty name
+var splits = make(map[string][]split)
+
+// Parses a split in the format "jar:percent:destination". The jar can be empty for tips without a jar
+func parseSplit(value string) (parsed split, err error) {
+	parts := strings.SplitN(value, ":", 3)
+
+	if len(parts) != 3 {
+		return parsed, errors.New("expected the format jar:percent:destination")
+	}
+
+	parsed.Jar = strings.TrimSpace(parts[0])
+	parsed.Destination = strings.TrimSpace(parts[2])
+
+	if _, ok := jars[parsed.Jar]; parsed.Jar != "" && !ok {
+		return parsed, errors.New("unknown jar")
+	}
+
+	parsed.Percent, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+
+	if err != nil || parsed.Percent <= 0 || parsed.Percent > 100 {
+		return parsed, errors.New("percent must be a number greater than 0 and not greater than 100")
+	}
+
+	_, err = getDestinationType(parsed.Destination)
+
+	return parsed, err
+}
+
+// Destinations are either Lightning Addresses, public keys of nodes for keysend payments or BOLT12 offers
+func getDestinationType(destination string) (string, error) {
+	if strings.Contains(destination, "@") {
+		return destinationLightningAddress, nil
+	}
+
+	if strings.HasPrefix(strings.ToLower(destination), "lno1") {
+		return destinationOffer, nil
+	}
+
+	if pubkey, err := hex.DecodeString(destination); err == nil && len(pubkey) == 33 {
+		return destinationKeysend, nil
+	}
+
+	return "", errors.New("destination is neither a Lightning Address, a public key nor an offer")
+}
+
+// Adds the splits from the config. The splits of jars that would pay out more than 100 percent are ignored
+func initSplits() {
+	for _, value := range cfg.Payouts.Splits {
+		parsed, err := parseSplit(value)
+
+		if err != nil {
+			log.Warning("Ignoring invalid split \"" + value + "\": " + err.Error())
+
+			continue
+		}
+
+		splits[parsed.Jar] = append(splits[parsed.Jar], parsed)
+	}
+
+	for jar, jarSplits := range splits {
+		var sum float64
+
+		for _, jarSplit := range jarSplits {
+			sum += jarSplit.Percent
+		}
+
+		if sum > 100 {
+			log.Warning("Ignoring splits of jar \"" + jar + "\" because they add up to more than 100 percent")
+
+			delete(splits, jar)
+		}
+
+	}
+
+}
+
+// Records the shares of a tip that have to be paid out. Tips that could not be recorded have the ID 0
+func addPayoutShares(tip int64, jar string, amountMsat int64) {
+	if tip == 0 || len(splits[jar]) == 0 {
+		return
+	}
+
+	var shares []database.PayoutShare
+
+	for _, jarSplit := range splits[jar] {
+		amount := getShareAmount(amountMsat, jarSplit.Percent)
+
+		if amount > 0 {
+			shares = append(shares, database.PayoutShare{
+				Destination: jarSplit.Destination,
+				AmountMsat:  amount,
+			})
+		}
+
+	}
+
+	if err := database.AddPayoutShares(tip, shares); err != nil {
+		log.Error("Failed to add payout shares to database: " + fmt.Sprint(err))
+	}
+
+}
+
+// Percentages of shares are precise to a millionth of a percent
+const sharePrecision = 1000000
+
+// Rounds the share of an amount down to whole millisatoshis. Multiplying the amount with the percentage as floating
+// point number could round a share of 57.4 percent of 1000 millisatoshis down to 573
+func getShareAmount(amountMsat int64, percent float64) int64 {
+	const divisor = 100 * sharePrecision
+
+	share := int64(math.Round(percent * sharePrecision))
+
+	// Splitting the amount prevents overflows because the share is not bigger than the divisor
+	return amountMsat/divisor*share + amountMsat%divisor*share/divisor
+}
+
+// Collects the shares into payouts and sends them at the payout interval
+func runPayouts() {
+	interrupted, err := database.FailInterruptedPayouts()
+
+	if err != nil {
+		log.Error("Failed to check for interrupted payouts: " + fmt.Sprint(err))
+	}
+
+	for _, payout := range interrupted {
+		log.Warning("Payout " + strconv.FormatInt(payout.ID, 10) + " of " + rates.FormatMsat(payout.AmountMsat) +
+			" satoshis to " + payout.Destination + " was interrupted. Check your node whether it was paid")
+	}
+
+	ticker := time.Tick(time.Duration(cfg.Payouts.Interval) * time.Second)
+
+	for {
+		processPayouts()
+
+		<-ticker
+	}
+
+}
+
+func processPayouts() {
+	batched, err := database.BatchPayoutShares(cfg.Payouts.MinAmount * 1000)
+
+	if err != nil {
+		log.Error("Failed to collect shares into payouts: " + fmt.Sprint(err))
+	}
+
+	if batched > 0 {
+		log.Debug("Created " + strconv.Itoa(batched) + " payouts")
+	}
+
+	payouts, err := database.GetDuePayouts(time.Now())
+
+	if err != nil {
+		log.Error("Failed to get payouts from database: " + fmt.Sprint(err))
+
+		return
+	}
+
+	for _, payout := range payouts {
+		sendPayout(payout)
+	}
+
+}
+
+// Payouts that definitely failed are retried with an increasing delay until the maximal number of attempts is
+// reached. Other errors leave open whether they were paid which is why those payouts have to be checked manually
+func sendPayout(payout database.Payout) {
+	err := database.StartPayoutAttempt(payout.ID)
+
+	if err != nil {
+		log.Error("Failed to update payout in database: " + fmt.Sprint(err))
+
+		return
+	}
+
+	maxFeeMsat := getMaxFee(payout.AmountMsat)
+
+	payment, err := payDestination(payout.Destination, payout.AmountMsat, maxFeeMsat)
+
+	now := time.Now()
+
+	attempt := database.PayoutAttempt{
+		Payout: payout.ID,
+		Date:   now,
+	}
+
+	state := database.PayoutPaid
+	nextAttempt := now
+
+	logMessage := "payout of " + rates.FormatMsat(payout.AmountMsat) + " satoshis to " + payout.Destination
+
+	if err == nil {
+		attempt.FeeMsat = payment.FeeMsat
+		attempt.Preimage = payment.Preimage
+
+		log.Info("Sent " + logMessage + " with fee of " + rates.FormatMsat(payment.FeeMsat) + " satoshis")
+
+	} else {
+		attempt.Error = err.Error()
+
+		attempts := payout.Attempts + 1
+
+		_, definitelyFailed := err.(*backends.PaymentFailedError)
+
+		// Retrying payments the backend doesn't support is pointless
+		if attempts >= cfg.Payouts.MaxAttempts || err == backends.ErrPaymentsNotSupported {
+			state = database.PayoutFailed
+
+			log.Error("Failed to send " + logMessage + ". Giving up: " + err.Error())
+
+		} else if !definitelyFailed {
+			// Retrying could pay twice just like after payouts were interrupted
+			state = database.PayoutFailed
+
+			log.Error("Sending " + logMessage + " returned an error after which it could have been paid anyway. " +
+				"Check your node whether it was paid: " + err.Error())
+
+		} else {
+			state = database.PayoutPending
+			nextAttempt = now.Add(time.Duration(attempts*cfg.Payouts.Interval) * time.Second)
+
+			log.Warning("Failed to send " + logMessage + ". Retrying at " + nextAttempt.Format(time.RFC3339) + ": " + err.Error())
+		}
+
+	}
+
+	err = database.RecordPayoutAttempt(attempt, state, nextAttempt)
+
+	if err != nil {
+		log.Error("Failed to record payout attempt in database: " + fmt.Sprint(err))
+	}
+
+}
+
+// Small payouts would fail on the base fees of the channels if their fee was limited by the percentage only
+func getMaxFee(amountMsat int64) int64 {
+	maxFeeMsat := int64(float64(amountMsat) * cfg.Payouts.MaxFee / 100)
+
+	if minFeeMsat := cfg.Payouts.MinFee * 1000; maxFeeMsat < minFeeMsat {
+		return minFeeMsat
+	}
+
+	return maxFeeMsat
+}
+
+// Errors that happen before the payment is sent mean that it failed
+func payDestination(destination string, amountMsat int64, maxFeeMsat int64) (payment backends.Payment, err error) {
+	destinationType, err := getDestinationType(destination)
+
+	if err != nil {
+		return payment, &backends.PaymentFailedError{Reason: err.Error()}
+	}
+
+	switch destinationType {
+	case destinationLightningAddress:
+		invoice, err := resolveLightningAddress(destination, amountMsat)
+
+		if err != nil {
+			return payment, &backends.PaymentFailedError{Reason: err.Error()}
+		}
+
+		return backend.PayInvoice(invoice, maxFeeMsat)
+
+	case destinationOffer:
+		return backend.PayOffer(destination, amountMsat, maxFeeMsat)
+
+	default:
+		return backend.SendKeysend(destination, amountMsat, maxFeeMsat)
+	}
+
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michael1011/lightningtip/backends"
+	"github.com/michael1011/lightningtip/database"
+)
+
+const testPubkey = "02eec7245d6b7d2ccb30380bfbe2a3648cd7a942653f5aa340edcea1f283686619"
+
+// A backend whose keysend payments end with an error that leaves open whether they were sent
+type timeoutBackend struct {
+	*backends.Mock
+}
+
+func (timeout timeoutBackend) SendKeysend(pubkey string, amountMsat int64, maxFeeMsat int64) (backends.Payment, error) {
+	return backends.Payment{}, errors.New("context deadline exceeded")
+}
+
+func TestParseSplit(t *testing.T) {
+	previousJars := jars
+	defer func() { jars = previousJars }()
+
+	jars = map[string]tipJar{"alice": {Name: "alice"}}
+
+	valid := map[string]split{
+		"alice:50:alice@example.com":    {Jar: "alice", Percent: 50, Destination: "alice@example.com"},
+		":12.5:" + testPubkey:           {Percent: 12.5, Destination: testPubkey},
+		" alice : 100 : lno1qcp4256ypq": {Jar: "alice", Percent: 100, Destination: "lno1qcp4256ypq"},
+	}
+
+	for value, expected := range valid {
+		parsed, err := parseSplit(value)
+
+		if err != nil || parsed != expected {
+			t.Errorf("unexpected split %v of %s: %v", parsed, value, err)
+		}
+
+	}
+
+	for _, value := range []string{
+		"alice:50",
+		"bob:50:bob@example.com",
+		"alice:0:alice@example.com",
+		"alice:101:alice@example.com",
+		"alice:half:alice@example.com",
+		"alice:50:nobody",
+	} {
+		if _, err := parseSplit(value); err == nil {
+			t.Errorf("invalid split %s was accepted", value)
+		}
+
+	}
+
+}
+
+func TestGetDestinationType(t *testing.T) {
+	destinations := map[string]string{
+		"alice@example.com": destinationLightningAddress,
+		testPubkey:          destinationKeysend,
+		"LNO1QCP4256YPQ":    destinationOffer,
+	}
+
+	for destination, expected := range destinations {
+		if destinationType, err := getDestinationType(destination); err != nil || destinationType != expected {
+			t.Errorf("unexpected type %s of %s: %v", destinationType, destination, err)
+		}
+
+	}
+
+	// Public keys have 33 bytes
+	for _, destination := range []string{testPubkey[2:], "lnbc1invoice", ""} {
+		if _, err := getDestinationType(destination); err == nil {
+			t.Errorf("invalid destination %s was accepted", destination)
+		}
+
+	}
+
+}
+
+func TestAddPayoutShares(t *testing.T) {
+	_, tearDown := setUpMockBackend(t)
+	defer tearDown()
+
+	previousSplits := splits
+	defer func() { splits = previousSplits }()
+
+	splits = map[string][]split{
+		"": {
+			{Percent: 57.4, Destination: "alice@example.com"},
+			{Percent: 33.3, Destination: testPubkey},
+			{Percent: 0.01, Destination: "bob@example.com"},
+		},
+	}
+
+	addPayoutShares(1, "", 1000)
+	addPayoutShares(2, "", 1000)
+
+	// Tips for jars without splits and ones that were not recorded are not paid out
+	addPayoutShares(3, "alice", 1000)
+	addPayoutShares(0, "", 1000)
+
+	if batched, err := database.BatchPayoutShares(1); err != nil || batched != 2 {
+		t.Fatalf("unexpected number of payouts %d: %v", batched, err)
+	}
+
+	payouts, _ := database.GetDuePayouts(time.Now())
+
+	// Shares are rounded down to whole millisatoshis and shares smaller than that are dropped
+	expected := map[string]int64{
+		"alice@example.com": 1148,
+		testPubkey:          666,
+	}
+
+	if len(payouts) != len(expected) {
+		t.Fatalf("unexpected payouts %v", payouts)
+	}
+
+	for _, payout := range payouts {
+		if payout.AmountMsat != expected[payout.Destination] {
+			t.Errorf("unexpected amount of payout %v", payout)
+		}
+
+	}
+
+	if share := getShareAmount(maxTipAmountMsat, 100); share != maxTipAmountMsat {
+		t.Errorf("share of biggest tip overflowed to %d", share)
+	}
+
+}
+
+func TestGetMaxFee(t *testing.T) {
+	previousPayouts := cfg.Payouts
+	defer func() { cfg.Payouts = previousPayouts }()
+
+	cfg.Payouts = &payoutOptions{
+		MaxFee: 1,
+		MinFee: 10,
+	}
+
+	// Small payouts may use the minimal fee and big ones the percentage
+	if maxFee := getMaxFee(100000); maxFee != 10000 {
+		t.Errorf("unexpected maximal fee %d of small payout", maxFee)
+	}
+
+	if maxFee := getMaxFee(10000000); maxFee != 100000 {
+		t.Errorf("unexpected maximal fee %d of big payout", maxFee)
+	}
+
+	cfg.Payouts.MinFee = 0
+
+	if maxFee := getMaxFee(100000); maxFee != 1000 {
+		t.Errorf("unexpected maximal fee %d without minimal fee", maxFee)
+	}
+
+}
+
+// Creates a payout of the amount to the destination and sends it once
+func sendTestPayout(t *testing.T, destination string, amountMsat int64) database.Payout {
+	if err := database.AddPayoutShares(1, []database.PayoutShare{{Destination: destination, AmountMsat: amountMsat}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := database.BatchPayoutShares(0); err != nil {
+		t.Fatal(err)
+	}
+
+	payouts, err := database.GetDuePayouts(time.Now())
+
+	if err != nil || len(payouts) != 1 {
+		t.Fatalf("unexpected payouts %v: %v", payouts, err)
+	}
+
+	sendPayout(payouts[0])
+
+	payout, err := database.GetPayout(payouts[0].ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return payout
+}
+
+func TestSendPayout(t *testing.T) {
+	mock, tearDown := setUpMockBackend(t)
+	defer tearDown()
+
+	cfg.Payouts = &payoutOptions{
+		Interval:    60,
+		MaxFee:      1,
+		MaxAttempts: 2,
+	}
+
+	if payout := sendTestPayout(t, testPubkey, 10000); payout.State != database.PayoutPaid || payout.Attempts != 1 {
+		t.Errorf("payout was not paid %v", payout)
+	}
+
+	// Payments that definitely failed are retried until the maximal number of attempts is reached
+	mock.FailPayments = true
+
+	payout := sendTestPayout(t, testPubkey, 20000)
+
+	if payout.State != database.PayoutPending || !payout.NextAttempt.After(time.Now().Add(time.Minute-time.Second)) {
+		t.Errorf("failed payout is not retried later %v", payout)
+	}
+
+	sendPayout(payout)
+
+	if payout, _ = database.GetPayout(payout.ID); payout.State != database.PayoutFailed || payout.Attempts != 2 {
+		t.Errorf("payout was not given up %v", payout)
+	}
+
+	// Invalid destinations can't be paid
+	if payout = sendTestPayout(t, "nobody", 1000); payout.State != database.PayoutPending {
+		t.Errorf("payout to invalid destination is not retried %v", payout)
+	}
+
+	database.RecordPayoutAttempt(database.PayoutAttempt{Payout: payout.ID, Date: time.Now()}, database.PayoutFailed, time.Now())
+
+	// Retrying errors after which the payment could have been sent anyway might pay twice
+	mock.FailPayments = false
+	backend = timeoutBackend{mock}
+
+	if payout = sendTestPayout(t, testPubkey, 30000); payout.State != database.PayoutFailed || payout.Attempts != 1 {
+		t.Errorf("payout that might have been sent is retried %v", payout)
+	}
+
+	// Payouts that were being sent when LightningTip stopped have to be checked manually as well
+	database.AddPayoutShares(2, []database.PayoutShare{{Destination: "alice@example.com", AmountMsat: 1000}})
+	database.BatchPayoutShares(0)
+
+	payouts, _ := database.GetDuePayouts(time.Now())
+
+	if len(payouts) != 1 {
+		t.Fatalf("unexpected payouts %v", payouts)
+	}
+
+	interrupted := payouts[0]
+
+	database.StartPayoutAttempt(interrupted.ID)
+
+	failed, err := database.FailInterruptedPayouts()
+
+	if err != nil || len(failed) != 1 || failed[0].ID != interrupted.ID {
+		t.Errorf("unexpected interrupted payouts %v: %v", failed, err)
+	}
+
+	if payout, _ = database.GetPayout(interrupted.ID); payout.State != database.PayoutFailed {
+		t.Errorf("interrupted payout was not marked as failed %v", payout)
+	}
+
+}
+
+func TestResolveLightningAddress(t *testing.T) {
+	mock, tearDown := setUpMockBackend(t)
+	defer tearDown()
+
+	metadata := `[["text/plain","Tips for Alice"],["text/identifier","alice@example.com"]]`
+
+	// The invoice of the callback can be replaced to test what happens with invoices the server should not return
+	var callbackInvoice func(amountMsat int64) string
+
+	var server *httptest.Server
+
+	server = httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case lnurlPayPath + "alice":
+			json.NewEncoder(writer).Encode(lnurlPayResponse{
+				Tag:         "payRequest",
+				Callback:    server.URL + "/callback",
+				MinSendable: 1000,
+				MaxSendable: 1000000,
+				Metadata:    metadata,
+			})
+
+		case "/callback":
+			amountMsat, _ := strconv.ParseInt(request.FormValue("amount"), 10, 64)
+
+			json.NewEncoder(writer).Encode(lnurlCallbackResponse{
+				PR: callbackInvoice(amountMsat),
+			})
+
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	previousClient := lnurlClient
+	lnurlClient = server.Client()
+
+	defer func() { lnurlClient = previousClient }()
+
+	address := "alice@" + strings.TrimPrefix(server.URL, "https://")
+
+	createInvoice := func(description string, amountMsat int64) string {
+		invoice, _, err := mock.GetInvoice(backends.InvoiceOptions{
+			Description:     description,
+			HashDescription: true,
+			AmountMsat:      amountMsat,
+			Expiry:          60,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return invoice
+	}
+
+	callbackInvoice = func(amountMsat int64) string {
+		return createInvoice(metadata, amountMsat)
+	}
+
+	if invoice, err := resolveLightningAddress(address, 21000); err != nil || invoice == "" {
+		t.Fatalf("could not resolve Lightning Address: %v", err)
+	}
+
+	if _, err := resolveLightningAddress(address, 2000000); err == nil {
+		t.Error("amount bigger than the maximum of the Lightning Address was accepted")
+	}
+
+	if _, err := resolveLightningAddress("bob@"+strings.TrimPrefix(server.URL, "https://"), 21000); err == nil {
+		t.Error("unknown Lightning Address was resolved")
+	}
+
+	callbackInvoice = func(amountMsat int64) string {
+		return createInvoice(metadata, amountMsat+1000)
+	}
+
+	if _, err := resolveLightningAddress(address, 21000); err == nil {
+		t.Error("invoice with different amount was accepted")
+	}
+
+	callbackInvoice = func(amountMsat int64) string {
+		return createInvoice("something else", amountMsat)
+	}
+
+	if _, err := resolveLightningAddress(address, 21000); err == nil {
+		t.Error("invoice that does not commit to the metadata was accepted")
+	}
+
+	callbackInvoice = func(amountMsat int64) string {
+		return "lnbcrt1invalid"
+	}
+
+	if _, err := resolveLightningAddress(address, 21000); err == nil {
+		t.Error("invalid invoice was accepted")
+	}
+
+}
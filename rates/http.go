@@ -0,0 +1,129 @@
+package rates
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP gets exchange rates from an API that responds in the format of the simple price API of CoinGecko:
+// {"bitcoin": {"eur": 12345.67}}
+type HTTP struct {
+	URL       string `long:"url" Description:"URL of the API. \"{currency}\" gets replaced with the currency in lower case"`
+	CacheTime int64  `long:"cachetime" Description:"Seconds for which rates are cached"`
+
+	lock  sync.Mutex
+	cache map[string]cachedRate
+
+	client *http.Client
+}
+
+type cachedRate struct {
+	rate    float64
+	fetched time.Time
+
+	// Currencies the API doesn't know are cached too to not ask it again for every request
+	unknown bool
+}
+
+// Rate gets the price of one bitcoin from the API or the cache
+func (provider *HTTP) Rate(currency string) (rate float64, err error) {
+	currency = normalizeCurrency(currency)
+
+	// The currency comes from the requests of clients and would be put in the URL of the API otherwise
+	if !isCurrencyCode(currency) {
+		return 0, ErrUnknownCurrency
+	}
+
+	provider.lock.Lock()
+
+	if provider.cache == nil {
+		provider.cache = make(map[string]cachedRate)
+
+		provider.client = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+
+	cached, ok := provider.cache[currency]
+
+	provider.lock.Unlock()
+
+	if ok && time.Since(cached.fetched) < time.Duration(provider.CacheTime)*time.Second {
+		if cached.unknown {
+			return 0, ErrUnknownCurrency
+		}
+
+		return cached.rate, nil
+	}
+
+	// The lock is not held while fetching so that a slow API doesn't block the rates of other currencies
+	rate, err = provider.fetch(currency)
+
+	if err != nil && err != ErrUnknownCurrency {
+		// A rate that is a little outdated is better than none at all
+		if ok && !cached.unknown {
+			log.Warning("Failed to fetch exchange rate of " + currency + ". Using cached one: " + err.Error())
+
+			return cached.rate, nil
+		}
+
+		return 0, err
+	}
+
+	provider.lock.Lock()
+
+	provider.cache[currency] = cachedRate{
+		rate:    rate,
+		fetched: time.Now(),
+		unknown: err == ErrUnknownCurrency,
+	}
+
+	provider.lock.Unlock()
+
+	return rate, err
+}
+
+func (provider *HTTP) fetch(currency string) (rate float64, err error) {
+	apiURL := strings.Replace(provider.URL, "{currency}", url.QueryEscape(strings.ToLower(currency)), -1)
+
+	response, err := provider.client.Get(apiURL)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return 0, errors.New("unexpected response status of rate API: " + response.Status)
+	}
+
+	data, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var prices map[string]map[string]float64
+
+	err = json.Unmarshal(data, &prices)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, price := range prices {
+		if rate, ok := price[strings.ToLower(currency)]; ok && rate > 0 {
+			return rate, nil
+		}
+
+	}
+
+	return 0, ErrUnknownCurrency
+}
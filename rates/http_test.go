@@ -0,0 +1,54 @@
+package rates
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPRate(t *testing.T) {
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		requests++
+
+		if r.URL.Query().Get("currency") == "eur" {
+			writer.Write([]byte(`{"bitcoin": {"eur": 12345.67}}`))
+
+			return
+		}
+
+		writer.Write([]byte(`{"bitcoin": {}}`))
+	}))
+	defer server.Close()
+
+	provider := &HTTP{
+		URL:       server.URL + "?currency={currency}",
+		CacheTime: 60,
+	}
+
+	for i := 0; i < 2; i++ {
+		if rate, err := provider.Rate("eur"); err != nil || rate != 12345.67 {
+			t.Errorf("unexpected rate %f: %v", rate, err)
+		}
+
+		// Unknown currencies have to be cached too
+		if _, err := provider.Rate("XYZ"); err != ErrUnknownCurrency {
+			t.Errorf("unexpected error for unknown currency %v", err)
+		}
+
+	}
+
+	// Anything that is no currency code must not be sent to the API
+	for _, currency := range []string{"eur&ids=ethereum", "EURO", "€", ""} {
+		if _, err := provider.Rate(currency); err != ErrUnknownCurrency {
+			t.Errorf("unexpected error for %q: %v", currency, err)
+		}
+
+	}
+
+	if requests != 2 {
+		t.Errorf("API was asked %d times instead of twice", requests)
+	}
+
+}
@@ -0,0 +1,10 @@
+package rates
+
+import "github.com/op/go-logging"
+
+var log logging.Logger
+
+// UseLogger tells the rates package which logger to use
+func UseLogger(logger logging.Logger) {
+	log = logger
+}
@@ -0,0 +1,47 @@
+package rates
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownCurrency is returned by providers that don't have a rate for a currency
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+var currencyCodeRegex = regexp.MustCompile("^[A-Z]{3}$")
+
+// Provider is an interface that allows for different sources of exchange rates to be used
+type Provider interface {
+	// Rate is the price of one bitcoin in the given currency
+	Rate(currency string) (rate float64, err error)
+}
+
+// ToMsat converts an amount of fiat into millisatoshis with the price of one bitcoin
+func ToMsat(fiat float64, rate float64) int64 {
+	return int64(math.Round(fiat / rate * 1e11))
+}
+
+// FormatMsat formats millisatoshis as satoshis with as many decimal places as necessary
+func FormatMsat(amountMsat int64) string {
+	satoshis := strconv.FormatInt(amountMsat/1000, 10)
+
+	if amountMsat%1000 == 0 {
+		return satoshis
+	}
+
+	return satoshis + "." + strings.TrimRight(fmt.Sprintf("%03d", amountMsat%1000), "0")
+}
+
+// Currency codes are compared in upper case
+func normalizeCurrency(currency string) string {
+	return strings.ToUpper(strings.TrimSpace(currency))
+}
+
+// Checks whether a normalized currency is an ISO 4217 code
+func isCurrencyCode(currency string) bool {
+	return currencyCodeRegex.MatchString(currency)
+}
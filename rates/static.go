@@ -0,0 +1,41 @@
+package rates
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+// Static reads exchange rates from a JSON file and can be used without internet connection. The file has to map
+// currencies to the price of one bitcoin: {"EUR": 12345.67, "USD": 13456.78}
+// It is read again for every rate to make sure changes are applied without restarting LightningTip
+type Static struct {
+	File string `long:"file" Description:"JSON file that maps currencies to the price of one bitcoin"`
+}
+
+// Rate gets the price of one bitcoin from the file
+func (provider *Static) Rate(currency string) (rate float64, err error) {
+	data, err := ioutil.ReadFile(provider.File)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var prices map[string]float64
+
+	err = json.Unmarshal(data, &prices)
+
+	if err != nil {
+		return 0, err
+	}
+
+	currency = normalizeCurrency(currency)
+
+	for name, price := range prices {
+		if normalizeCurrency(name) == currency && price > 0 {
+			return price, nil
+		}
+
+	}
+
+	return 0, ErrUnknownCurrency
+}
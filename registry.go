@@ -0,0 +1,204 @@
+package main
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// invoiceRegistry keeps track of the pending invoices and is safe for concurrent use
+// Invoices can be looked up by invoice and payment hash in constant time and the
+// ones that expired are found with a min-heap ordered by expiry
+type invoiceRegistry struct {
+	lock sync.Mutex
+
+	byInvoice map[string]*registryEntry
+	byRHash   map[string]*registryEntry
+
+	expiries expiryHeap
+
+	// Receives a value when an invoice was added to wake up whoever waits for the next expiry
+	added chan struct{}
+}
+
+type registryEntry struct {
+	invoice PendingInvoice
+
+	// Index of the entry in the expiry heap
+	index int
+}
+
+func newInvoiceRegistry() *invoiceRegistry {
+	return &invoiceRegistry{
+		byInvoice: make(map[string]*registryEntry),
+		byRHash:   make(map[string]*registryEntry),
+		added:     make(chan struct{}, 1),
+	}
+}
+
+// Add adds an invoice or replaces the one with the same invoice string
+func (registry *invoiceRegistry) Add(invoice PendingInvoice) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	registry.remove(invoice.Invoice)
+
+	entry := &registryEntry{
+		invoice: invoice,
+	}
+
+	registry.byInvoice[invoice.Invoice] = entry
+	registry.byRHash[invoice.RHash] = entry
+
+	heap.Push(&registry.expiries, entry)
+
+	select {
+	case registry.added <- struct{}{}:
+	default:
+	}
+
+}
+
+// Added returns a channel that receives a value when invoices were added
+func (registry *invoiceRegistry) Added() <-chan struct{} {
+	return registry.added
+}
+
+// NextExpiry returns the expiry of the invoice that expires first. ok is false if there are no invoices
+func (registry *invoiceRegistry) NextExpiry() (expiry time.Time, ok bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if len(registry.expiries) == 0 {
+		return time.Time{}, false
+	}
+
+	return registry.expiries[0].invoice.Expiry, true
+}
+
+// GetByInvoice looks up a pending invoice by its invoice string
+func (registry *invoiceRegistry) GetByInvoice(invoice string) (PendingInvoice, bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	entry, ok := registry.byInvoice[invoice]
+
+	if !ok {
+		return PendingInvoice{}, false
+	}
+
+	return entry.invoice, true
+}
+
+// GetByRHash looks up a pending invoice by its payment hash
+func (registry *invoiceRegistry) GetByRHash(rHash string) (PendingInvoice, bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	entry, ok := registry.byRHash[rHash]
+
+	if !ok {
+		return PendingInvoice{}, false
+	}
+
+	return entry.invoice, true
+}
+
+// Remove removes an invoice and returns it. Only one of multiple concurrent callers
+// for the same invoice gets it returned which makes sure it is processed only once
+func (registry *invoiceRegistry) Remove(invoice string) (PendingInvoice, bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	return registry.remove(invoice)
+}
+
+// RemoveExpired removes and returns all invoices that expired before the given time
+func (registry *invoiceRegistry) RemoveExpired(now time.Time) (expired []PendingInvoice) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	for len(registry.expiries) > 0 && now.Sub(registry.expiries[0].invoice.Expiry) > 0 {
+		entry := heap.Pop(&registry.expiries).(*registryEntry)
+
+		delete(registry.byInvoice, entry.invoice.Invoice)
+		delete(registry.byRHash, entry.invoice.RHash)
+
+		expired = append(expired, entry.invoice)
+	}
+
+	return expired
+}
+
+// All returns a copy of all pending invoices
+func (registry *invoiceRegistry) All() []PendingInvoice {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	invoices := make([]PendingInvoice, 0, len(registry.byInvoice))
+
+	for _, entry := range registry.byInvoice {
+		invoices = append(invoices, entry.invoice)
+	}
+
+	return invoices
+}
+
+// Len returns the number of pending invoices
+func (registry *invoiceRegistry) Len() int {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	return len(registry.byInvoice)
+}
+
+// The lock has to be held by the caller
+func (registry *invoiceRegistry) remove(invoice string) (PendingInvoice, bool) {
+	entry, ok := registry.byInvoice[invoice]
+
+	if !ok {
+		return PendingInvoice{}, false
+	}
+
+	delete(registry.byInvoice, invoice)
+	delete(registry.byRHash, entry.invoice.RHash)
+
+	heap.Remove(&registry.expiries, entry.index)
+
+	return entry.invoice, true
+}
+
+// expiryHeap implements heap.Interface with the invoice that expires first at the top
+type expiryHeap []*registryEntry
+
+func (expiries expiryHeap) Len() int { return len(expiries) }
+
+func (expiries expiryHeap) Less(i, j int) bool {
+	return expiries[i].invoice.Expiry.Before(expiries[j].invoice.Expiry)
+}
+
+func (expiries expiryHeap) Swap(i, j int) {
+	expiries[i], expiries[j] = expiries[j], expiries[i]
+
+	expiries[i].index = i
+	expiries[j].index = j
+}
+
+func (expiries *expiryHeap) Push(value interface{}) {
+	entry := value.(*registryEntry)
+	entry.index = len(*expiries)
+
+	*expiries = append(*expiries, entry)
+}
+
+func (expiries *expiryHeap) Pop() interface{} {
+	old := *expiries
+	last := len(old) - 1
+
+	entry := old[last]
+	old[last] = nil
+
+	*expiries = old[:last]
+
+	return entry
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestInvoice(index int, expiry time.Time) PendingInvoice {
+	return PendingInvoice{
+		Invoice: "lnbc" + strconv.Itoa(index),
+		RHash:   strconv.Itoa(index),
+		Expiry:  expiry,
+	}
+}
+
+func TestRegistryRemoveExpired(t *testing.T) {
+	registry := newInvoiceRegistry()
+
+	now := time.Now()
+
+	registry.Add(newTestInvoice(0, now.Add(time.Minute)))
+	registry.Add(newTestInvoice(1, now.Add(-time.Minute)))
+	registry.Add(newTestInvoice(2, now.Add(-time.Hour)))
+
+	// Replacing an invoice has to update its expiry
+	registry.Add(newTestInvoice(0, now.Add(-time.Second)))
+
+	select {
+	case <-registry.Added():
+	default:
+		t.Error("adding invoices was not signaled")
+	}
+
+	if next, ok := registry.NextExpiry(); !ok || !next.Equal(now.Add(-time.Hour)) {
+		t.Errorf("unexpected next expiry %v", next)
+	}
+
+	expired := registry.RemoveExpired(now)
+
+	if len(expired) != 3 || expired[0].RHash != "2" || expired[1].RHash != "1" || expired[2].RHash != "0" {
+		t.Fatalf("unexpected expired invoices %v", expired)
+	}
+
+	if _, ok := registry.NextExpiry(); ok {
+		t.Errorf("%d invoices left in registry", registry.Len())
+	}
+
+}
+
+func TestRegistryConcurrentUse(t *testing.T) {
+	const invoices = 200
+
+	registry := newInvoiceRegistry()
+
+	now := time.Now()
+
+	var wait sync.WaitGroup
+
+	// Every other invoice is expired already
+	for i := 0; i < invoices; i++ {
+		wait.Add(1)
+
+		go func(i int) {
+			defer wait.Done()
+
+			expiry := now.Add(time.Hour)
+
+			if i%2 == 0 {
+				expiry = now.Add(-time.Hour)
+			}
+
+			registry.Add(newTestInvoice(i, expiry))
+		}(i)
+	}
+
+	wait.Wait()
+
+	if registry.Len() != invoices {
+		t.Fatalf("registry has %d invoices instead of %d", registry.Len(), invoices)
+	}
+
+	var lock sync.Mutex
+	removed := make(map[string]int)
+
+	count := func(invoice PendingInvoice) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		removed[invoice.RHash]++
+	}
+
+	// Settled invoices are removed by the subscription and by the status requests of clients while the
+	// expired ones are removed at the same time
+	for i := 0; i < invoices; i++ {
+		for j := 0; j < 2; j++ {
+			wait.Add(1)
+
+			go func(i int) {
+				defer wait.Done()
+
+				pending, ok := registry.GetByRHash(strconv.Itoa(i))
+
+				if !ok {
+					return
+				}
+
+				if invoice, ok := registry.Remove(pending.Invoice); ok {
+					count(invoice)
+				}
+
+			}(i)
+		}
+
+		wait.Add(1)
+
+		go func() {
+			defer wait.Done()
+
+			for _, invoice := range registry.RemoveExpired(now) {
+				count(invoice)
+			}
+
+		}()
+	}
+
+	wait.Wait()
+
+	if registry.Len() != 0 {
+		t.Errorf("%d invoices left in registry", registry.Len())
+	}
+
+	for i := 0; i < invoices; i++ {
+		if removed[strconv.Itoa(i)] != 1 {
+			t.Errorf("invoice %d was returned %d times", i, removed[strconv.Itoa(i)])
+		}
+
+	}
+
+}
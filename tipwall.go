@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/michael1011/lightningtip/database"
+)
+
+// The maximal length of nicknames in characters
+const maxNicknameLength = 50
+
+// recentTip is a tip as it is shown publicly on the tip wall
+type recentTip struct {
+	ID         int64
+	Date       int64
+	Amount     int64
+	AmountMsat int64
+	Message    string
+	Nickname   string
+	Goal       string
+	Jar        string
+	Fiat       float64
+	Currency   string
+}
+
+// tipEvent is sent to the EventSource stream when a tip was received
+type tipEvent recentTip
+
+// To use the tipEvent type as event for the EventSource stream
+
+// Id gets the ID of the event which is not needed in our scenario
+func (event tipEvent) Id() string { return "" } // nolint: golint
+
+// Event is for telling tips apart from the payment hashes of settled invoices
+func (event tipEvent) Event() string { return "tip" }
+
+// Data is the tip encoded as JSON
+func (event tipEvent) Data() string {
+	data, _ := json.Marshal(event)
+
+	return string(data)
+}
+
+// tipHiddenEvent is sent to the EventSource stream when a tip was hidden or deleted so that clients remove it
+type tipHiddenEvent int64
+
+// Id gets the ID of the event which is not needed in our scenario
+func (event tipHiddenEvent) Id() string { return "" } // nolint: golint
+
+// Event is for telling hidden tips apart from the payment hashes of settled invoices
+func (event tipHiddenEvent) Event() string { return "tiphidden" }
+
+// Data is the ID of the tip
+func (event tipHiddenEvent) Data() string { return strconv.FormatInt(int64(event), 10) }
+
+// Lists the most recent tips that are not hidden. The number of tips can be reduced with the query parameter "limit"
+// and the query parameter "jar" shows only the tips for that jar
+func recentTipsHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeError(writer, couldNotParseError)
+
+		return
+	}
+
+	limit := cfg.TipWallSize
+
+	if value := request.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+
+		if err != nil || parsed < 1 {
+			writeError(writer, couldNotParseError)
+
+			return
+		}
+
+		if parsed < limit {
+			limit = parsed
+		}
+
+	}
+
+	tips, err := database.GetTips(database.TipFilter{
+		Jar:           request.URL.Query().Get("jar"),
+		ExcludeHidden: true,
+		Limit:         limit,
+	})
+
+	if err != nil {
+		log.Error("Failed to get recent tips from database: " + fmt.Sprint(err))
+
+		writeError(writer, "Failed to get recent tips")
+
+		return
+	}
+
+	response := []recentTip{}
+
+	for _, tip := range tips {
+		response = append(response, recentTip{
+			ID:         tip.ID,
+			Date:       tip.Date.Unix(),
+			Amount:     tip.AmountMsat / 1000,
+			AmountMsat: tip.AmountMsat,
+			Message:    tip.Message,
+			Nickname:   tip.Nickname,
+			Goal:       tip.Goal,
+			Jar:        tip.Jar,
+			Fiat:       tip.Fiat,
+			Currency:   tip.Currency,
+		})
+	}
+
+	writer.Write(marshalJSON(response))
+}
+
+// Pushes a tip that was just recorded to the tip wall. Tips that could not be recorded have the ID 0
+// New tips are pushed once they were approved if approval is required
+func publishTip(id int64, tip PendingInvoice) {
+	if !cfg.TipWall || cfg.TipWallApproval || id == 0 {
+		return
+	}
+
+	eventSrv.Publish([]string{eventChannel}, tipEvent{
+		ID:         id,
+		Date:       time.Now().Unix(),
+		Amount:     tip.AmountMsat / 1000,
+		AmountMsat: tip.AmountMsat,
+		Message:    tip.Message,
+		Nickname:   tip.Nickname,
+		Goal:       tip.Goal,
+		Jar:        tip.Jar,
+		Fiat:       tip.Fiat,
+		Currency:   tip.Currency,
+	})
+}
+
+// Pushes a tip to the tip wall after it was approved via the admin interface
+func publishApprovedTip(tip database.Tip) {
+	if !cfg.TipWall {
+		return
+	}
+
+	eventSrv.Publish([]string{eventChannel}, tipEvent{
+		ID:         tip.ID,
+		Date:       tip.Date.Unix(),
+		Amount:     tip.AmountMsat / 1000,
+		AmountMsat: tip.AmountMsat,
+		Message:    tip.Message,
+		Nickname:   tip.Nickname,
+		Goal:       tip.Goal,
+		Jar:        tip.Jar,
+		Fiat:       tip.Fiat,
+		Currency:   tip.Currency,
+	})
+}
+
+// Tells the clients of the tip wall to remove a tip
+func publishTipHidden(id int64) {
+	if cfg.TipWall {
+		eventSrv.Publish([]string{eventChannel}, tipHiddenEvent(id))
+	}
+
+}
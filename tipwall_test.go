@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/michael1011/lightningtip/database"
+)
+
+func getRecentTips(t *testing.T) []database.Tip {
+	tips, err := database.GetTips(database.TipFilter{ExcludeHidden: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tips
+}
+
+func TestTipWallApproval(t *testing.T) {
+	mock, tearDown := setUpHoldInvoices(t, holdModeFilter)
+	defer tearDown()
+
+	cfg.TipWall = true
+	cfg.TipWallApproval = true
+
+	payHoldInvoice(t, mock, "thanks")
+
+	if tips := getRecentTips(t); len(tips) != 0 {
+		t.Fatalf("tip was shown before it was approved %v", tips)
+	}
+
+	tips, err := database.GetTips(database.TipFilter{})
+
+	if err != nil || len(tips) != 1 {
+		t.Fatalf("tip was not recorded %v: %v", tips, err)
+	}
+
+	body := `{"ID": ` + strconv.FormatInt(tips[0].ID, 10) + `, "Hidden": false}`
+
+	recorder := httptest.NewRecorder()
+	hideTipHandler(recorder, httptest.NewRequest(http.MethodPost, "/tips/hide", strings.NewReader(body)))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	if tips := getRecentTips(t); len(tips) != 1 || tips[0].Message != "thanks" {
+		t.Errorf("approved tip is not shown %v", tips)
+	}
+
+}
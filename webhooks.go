@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/michael1011/lightningtip/database"
+)
+
+// Events that are posted to the webhook URLs
+const (
+	webhookInvoiceCreated  = "invoice.created"
+	webhookInvoiceSettled  = "invoice.settled"
+	webhookInvoiceExpired  = "invoice.expired"
+	webhookInvoiceCanceled = "invoice.canceled"
+)
+
+// How often the queue is checked for deliveries whose retry is due
+const webhookCheckInterval = 5 * time.Second
+
+// The delay between retries doubles with every failed attempt but is never longer than this
+const maxWebhookRetryDelay = 24 * time.Hour
+
+// Wakes up the delivery of webhooks when an event was queued. Buffered so that queueing never blocks
+var webhookQueued = make(chan struct{}, 1)
+
+// The body of the requests to the webhook URLs. Keysend tips have no invoice and no expiry
+// All timestamps are in seconds since the Unix epoch and zero if they are not known yet
+type webhookPayload struct {
+	Event string
+	Date  int64
+
+	Invoice string
+	RHash   string
+	Keysend bool
+
+	Amount     int64
+	AmountMsat int64
+	Message    string
+	Nickname   string
+	Goal       string
+	Jar        string
+
+	Fiat     float64
+	Currency string
+	Rate     float64
+
+	Expiry     int64
+	SettleDate int64
+}
+
+func newWebhookPayload(event string, invoice PendingInvoice) webhookPayload {
+	now := time.Now()
+
+	payload := webhookPayload{
+		Event:      event,
+		Date:       now.Unix(),
+		Invoice:    invoice.Invoice,
+		RHash:      invoice.RHash,
+		Amount:     invoice.AmountMsat / 1000,
+		AmountMsat: invoice.AmountMsat,
+		Message:    invoice.Message,
+		Nickname:   invoice.Nickname,
+		Goal:       invoice.Goal,
+		Jar:        invoice.Jar,
+		Fiat:       invoice.Fiat,
+		Currency:   invoice.Currency,
+		Rate:       invoice.Rate,
+	}
+
+	if !invoice.Expiry.IsZero() {
+		payload.Expiry = invoice.Expiry.Unix()
+	}
+
+	if event == webhookInvoiceSettled {
+		payload.SettleDate = payload.Date
+	}
+
+	return payload
+}
+
+// Adds an event to the queue in the database from which it is delivered to every webhook URL
+func queueWebhook(payload webhookPayload) {
+	if len(cfg.Webhook.URLs) == 0 {
+		return
+	}
+
+	err := database.AddWebhookDeliveries(cfg.Webhook.URLs, payload.Event, marshalJSON(payload))
+
+	if err != nil {
+		log.Error("Failed to add webhook deliveries to database: " + fmt.Sprint(err))
+
+		return
+	}
+
+	select {
+	case webhookQueued <- struct{}{}:
+	default:
+	}
+}
+
+// Delivers queued events right away and retries failed deliveries when they are due
+// Events that were queued before LightningTip stopped are delivered after it was started again
+func runWebhooks() {
+	ticker := time.Tick(webhookCheckInterval)
+
+	for {
+		deliverWebhooks()
+
+		select {
+		case <-webhookQueued:
+		case <-ticker:
+		}
+	}
+}
+
+func deliverWebhooks() {
+	deliveries, err := database.GetDueWebhookDeliveries(time.Now())
+
+	if err != nil {
+		log.Error("Failed to get webhook deliveries from database: " + fmt.Sprint(err))
+
+		return
+	}
+
+	for _, delivery := range deliveries {
+		deliverWebhook(delivery)
+	}
+
+}
+
+// Failed deliveries are retried with exponential backoff until the maximal number of attempts is reached
+func deliverWebhook(delivery database.WebhookDelivery) {
+	status, err := cfg.Webhook.Send(delivery.URL, delivery.ID, delivery.Payload)
+
+	now := time.Now()
+
+	attempt := database.WebhookAttempt{
+		Delivery: delivery.ID,
+		Date:     now,
+		Status:   status,
+	}
+
+	state := database.WebhookDelivered
+	nextAttempt := now
+
+	logMessage := "event " + delivery.Event + " to " + delivery.URL
+
+	if err == nil {
+		log.Debug("Delivered " + logMessage)
+
+	} else {
+		attempt.Error = err.Error()
+
+		attempts := delivery.Attempts + 1
+
+		if attempts >= cfg.Webhook.MaxAttempts {
+			state = database.WebhookFailed
+
+			log.Error("Failed to deliver " + logMessage + ". Giving up: " + err.Error())
+
+		} else {
+			state = database.WebhookPending
+			nextAttempt = now.Add(getWebhookRetryDelay(attempts))
+
+			log.Warning("Failed to deliver " + logMessage + ". Retrying at " + nextAttempt.Format(time.RFC3339) + ": " + err.Error())
+		}
+
+	}
+
+	err = database.RecordWebhookAttempt(attempt, state, nextAttempt)
+
+	if err != nil {
+		log.Error("Failed to record webhook attempt in database: " + fmt.Sprint(err))
+	}
+
+}
+
+func getWebhookRetryDelay(attempts int64) time.Duration {
+	delay := time.Duration(cfg.Webhook.RetryInterval) * time.Second
+
+	for i := int64(1); i < attempts; i++ {
+		delay *= 2
+
+		if delay >= maxWebhookRetryDelay {
+			return maxWebhookRetryDelay
+		}
+
+	}
+
+	return delay
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/michael1011/lightningtip/database"
+	"github.com/michael1011/lightningtip/notifications"
+)
+
+// A webhook receiver that fails the first requests and records all of them
+type webhookReceiver struct {
+	sync.Mutex
+
+	failures   int
+	deliveries []string
+	signatures []string
+	payloads   []webhookPayload
+}
+
+func (receiver *webhookReceiver) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	receiver.Lock()
+	defer receiver.Unlock()
+
+	body, _ := ioutil.ReadAll(request.Body)
+
+	var payload webhookPayload
+	json.Unmarshal(body, &payload)
+
+	mac := hmac.New(sha256.New, []byte(cfg.Webhook.Secret))
+	mac.Write(body)
+
+	receiver.deliveries = append(receiver.deliveries, request.Header.Get("X-LightningTip-Delivery"))
+	receiver.payloads = append(receiver.payloads, payload)
+
+	// Only valid signatures are recorded
+	if request.Header.Get("X-LightningTip-Signature") == "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		receiver.signatures = append(receiver.signatures, request.Header.Get("X-LightningTip-Signature"))
+	}
+
+	if receiver.failures > 0 {
+		receiver.failures--
+
+		writer.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	writer.WriteHeader(http.StatusOK)
+}
+
+// Gets the deliveries that are due at the time
+func getDueWebhooks(t *testing.T, now time.Time) []database.WebhookDelivery {
+	deliveries, err := database.GetDueWebhookDeliveries(now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return deliveries
+}
+
+func TestGetWebhookRetryDelay(t *testing.T) {
+	previousWebhook := cfg.Webhook
+	defer func() { cfg.Webhook = previousWebhook }()
+
+	cfg.Webhook = &notifications.Webhook{RetryInterval: 60}
+
+	delays := map[int64]time.Duration{
+		1:    time.Minute,
+		2:    2 * time.Minute,
+		5:    16 * time.Minute,
+		11:   1024 * time.Minute,
+		12:   maxWebhookRetryDelay,
+		1000: maxWebhookRetryDelay,
+	}
+
+	for attempts, expected := range delays {
+		if delay := getWebhookRetryDelay(attempts); delay != expected {
+			t.Errorf("unexpected delay %v after %d attempts", delay, attempts)
+		}
+
+	}
+
+}
+
+func TestDeliverWebhooks(t *testing.T) {
+	_, tearDown := setUpMockBackend(t)
+	defer tearDown()
+
+	receiver := &webhookReceiver{failures: 1}
+
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	cfg.Webhook = &notifications.Webhook{
+		URLs:          []string{server.URL},
+		Secret:        "secret",
+		Timeout:       10,
+		RetryInterval: 60,
+		MaxAttempts:   3,
+	}
+
+	invoice := addTestInvoice(t, time.Now().Add(time.Hour))
+
+	deliverWebhooks()
+
+	// The failed delivery is retried after the retry interval
+	if due := getDueWebhooks(t, time.Now()); len(due) != 0 {
+		t.Errorf("failed delivery was retried right away %v", due)
+	}
+
+	due := getDueWebhooks(t, time.Now().Add(time.Minute+time.Second))
+
+	if len(due) != 1 || due[0].Attempts != 1 {
+		t.Fatalf("unexpected deliveries to retry %v", due)
+	}
+
+	deliverWebhook(due[0])
+
+	if due = getDueWebhooks(t, time.Now().Add(maxWebhookRetryDelay)); len(due) != 0 {
+		t.Errorf("delivered event is still pending %v", due)
+	}
+
+	receiver.Lock()
+	defer receiver.Unlock()
+
+	// Receivers can ignore duplicates because the ID of the delivery is the same for all attempts
+	if len(receiver.deliveries) != 2 || receiver.deliveries[0] == "" || receiver.deliveries[0] != receiver.deliveries[1] {
+		t.Errorf("unexpected delivery IDs %v", receiver.deliveries)
+	}
+
+	if len(receiver.signatures) != 2 {
+		t.Errorf("%d of %d requests had a valid signature", len(receiver.signatures), len(receiver.deliveries))
+	}
+
+	for _, payload := range receiver.payloads {
+		if payload.Event != webhookInvoiceCreated || payload.RHash != invoice.RHash || payload.AmountMsat != invoice.AmountMsat {
+			t.Errorf("unexpected payload %v", payload)
+		}
+
+	}
+
+}
+
+func TestDeliverWebhooksGiveUp(t *testing.T) {
+	_, tearDown := setUpMockBackend(t)
+	defer tearDown()
+
+	receiver := &webhookReceiver{failures: 2}
+
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	cfg.Webhook = &notifications.Webhook{
+		URLs:          []string{server.URL},
+		Timeout:       10,
+		RetryInterval: 60,
+		MaxAttempts:   2,
+	}
+
+	addTestInvoice(t, time.Now().Add(time.Hour))
+
+	deliverWebhooks()
+
+	due := getDueWebhooks(t, time.Now().Add(time.Minute+time.Second))
+
+	if len(due) != 1 {
+		t.Fatalf("unexpected deliveries to retry %v", due)
+	}
+
+	deliverWebhook(due[0])
+
+	// Deliveries are not retried anymore after the maximal number of attempts
+	if due = getDueWebhooks(t, time.Now().Add(maxWebhookRetryDelay)); len(due) != 0 {
+		t.Errorf("delivery was not given up %v", due)
+	}
+
+	receiver.Lock()
+	defer receiver.Unlock()
+
+	if len(receiver.deliveries) != 2 {
+		t.Errorf("event was delivered %d times", len(receiver.deliveries))
+	}
+
+}
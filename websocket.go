@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"golang.org/x/net/websocket"
+)
+
+// websocketRequest is sent by clients to choose the invoices they get events for
+type websocketRequest struct {
+	Subscribe   []string
+	Unsubscribe []string
+}
+
+// To prevent a single client from subscribing to an unreasonable amount of invoices
+const maxWebsocketSubscriptions = 100
+
+var websocketServer = websocket.Server{
+	Handshake: checkWebsocketOrigin,
+	Handler:   websocketHandler,
+}
+
+// Browsers always send an Origin header which has to match the "accessdomain" or the host of LightningTip
+// Other clients don't send one and are allowed
+func checkWebsocketOrigin(config *websocket.Config, request *http.Request) (err error) {
+	config.Origin, err = websocket.Origin(config, request)
+
+	if err != nil || config.Origin == nil {
+		return err
+	}
+
+	if cfg.AccessDomain == "*" || config.Origin.String() == cfg.AccessDomain || config.Origin.Host == request.Host {
+		return nil
+	}
+
+	return errors.New("origin not allowed")
+}
+
+// Sends an invoiceEvent for every change of the state of the subscribed invoices. Right after subscribing to an
+// invoice its current state is sent. Invoices are unsubscribed automatically once they can't change their state anymore
+func websocketHandler(con *websocket.Conn) {
+	defer con.Close()
+
+	events := make(chan invoiceEvent, 16)
+	subscribed := make(map[string]bool)
+
+	defer func() {
+		for rHash := range subscribed {
+			subscriptions.unsubscribe(rHash, events)
+		}
+	}()
+
+	requests := make(chan websocketRequest)
+	done := make(chan struct{})
+
+	defer close(done)
+
+	go func() {
+		defer close(requests)
+
+		for {
+			var request websocketRequest
+
+			if err := websocket.JSON.Receive(con, &request); err != nil {
+				return
+			}
+
+			select {
+			case requests <- request:
+			case <-done:
+				return
+			}
+		}
+
+	}()
+
+	send := func(event invoiceEvent) error {
+		if event.final() && subscribed[event.RHash] {
+			subscriptions.unsubscribe(event.RHash, events)
+
+			delete(subscribed, event.RHash)
+		}
+
+		return websocket.JSON.Send(con, event)
+	}
+
+	for {
+		select {
+		case request, ok := <-requests:
+			if !ok {
+				return
+			}
+
+			for _, rHash := range request.Unsubscribe {
+				if subscribed[rHash] {
+					subscriptions.unsubscribe(rHash, events)
+
+					delete(subscribed, rHash)
+				}
+			}
+
+			for _, rHash := range request.Subscribe {
+				if subscribed[rHash] || rHash == "" || len(subscribed) >= maxWebsocketSubscriptions {
+					continue
+				}
+
+				// Subscribing before checking the current state makes sure no event is missed
+				subscriptions.subscribe(rHash, events)
+
+				subscribed[rHash] = true
+
+				err := send(invoiceEvent{
+					RHash: rHash,
+					State: getInvoiceState(rHash, false).State,
+				})
+
+				if err != nil {
+					return
+				}
+			}
+
+		case event := <-events:
+			if err := send(event); err != nil {
+				return
+			}
+		}
+
+	}
+
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michael1011/lightningtip/backends"
+	"github.com/michael1011/lightningtip/database"
+	"golang.org/x/net/websocket"
+)
+
+func TestWebsocketOrigin(t *testing.T) {
+	previousCfg := cfg
+	defer func() { cfg = previousCfg }()
+
+	server := httptest.NewServer(websocketServer)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	cfg.AccessDomain = "https://example.com"
+
+	origins := map[string]bool{
+		server.URL:             true,
+		"https://example.com":  true,
+		"https://evil.example": false,
+		"http://example.com":   false,
+	}
+
+	for origin, allowed := range origins {
+		con, err := websocket.Dial(url, "", origin)
+
+		if err == nil {
+			con.Close()
+		}
+
+		if allowed != (err == nil) {
+			t.Errorf("unexpected result for origin %s: %v", origin, err)
+		}
+
+	}
+
+	cfg.AccessDomain = "*"
+
+	con, err := websocket.Dial(url, "", "https://evil.example")
+
+	if err != nil {
+		t.Fatalf("origin was not allowed with wildcard access domain: %v", err)
+	}
+
+	con.Close()
+}
+
+func TestWebsocketEvents(t *testing.T) {
+	_, tearDown := setUpMockBackend(t)
+	defer tearDown()
+
+	server := httptest.NewServer(websocketServer)
+	defer server.Close()
+
+	con, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", "", server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer con.Close()
+
+	con.SetDeadline(time.Now().Add(10 * time.Second))
+
+	receive := func(rHash string, state string) {
+		var event invoiceEvent
+
+		if err := websocket.JSON.Receive(con, &event); err != nil {
+			t.Fatal(err)
+		}
+
+		if event.RHash != rHash || event.State != state {
+			t.Errorf("unexpected event %v instead of %s for %s", event, state, rHash)
+		}
+
+	}
+
+	first := addTestInvoice(t, time.Now().Add(time.Hour))
+	second := addTestInvoice(t, time.Now().Add(time.Hour))
+
+	// The current state is sent right after subscribing
+	websocket.JSON.Send(con, websocketRequest{Subscribe: []string{first.RHash, second.RHash, "00"}})
+
+	receive(first.RHash, database.InvoicePending)
+	receive(second.RHash, database.InvoicePending)
+	receive("00", invoiceUnknown)
+
+	// Events of invoices that were unsubscribed must not be sent
+	// Requests are handled in order which is why the unsubscription is done once the state of the unknown invoice arrives
+	websocket.JSON.Send(con, websocketRequest{Unsubscribe: []string{second.RHash}})
+	websocket.JSON.Send(con, websocketRequest{Subscribe: []string{"01"}})
+
+	receive("01", invoiceUnknown)
+
+	publishInvoiceSettled(backends.SettledInvoice{Invoice: second.Invoice, RHash: second.RHash})
+	publishInvoiceSettled(backends.SettledInvoice{Invoice: first.Invoice, RHash: first.RHash})
+
+	receive(first.RHash, database.InvoiceSettled)
+
+	// Subscribing to the settled invoice again gets its final state
+	websocket.JSON.Send(con, websocketRequest{Subscribe: []string{second.RHash}})
+
+	receive(second.RHash, database.InvoiceSettled)
+}